@@ -0,0 +1,446 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// VolumeBuilder 在内存中构造合成的FAT32卷
+// 可指定扇区与簇大小、碎片化簇链、长文件名、嵌套目录与空文件，用于测试删除逻辑
+type VolumeBuilder struct {
+	BytesPerSector    uint16
+	SectorsPerCluster uint8
+	ReservedSectors   uint16
+	NumFATs           uint8
+	Flags             uint16    // 写入引导扇区的 Flags，第7位置位时关闭FAT镜像
+	ClusterCount      uint32    // 数据区簇数，FAT32至少为65525
+	Time              time.Time // 目录项中写入的时间戳
+	CodePage          *CodePage // 显式指定的短文件名使用的代码页，用于判断是否需要长文件名项
+
+	root *BuildEntry
+	used map[uint32]bool
+	next uint32
+	err  error
+}
+
+// BuildEntry 合成卷中的一个文件或目录，构建完成后回填簇号链与目录项偏移
+type BuildEntry struct {
+	Name      string
+	ShortName [11]byte // 短文件名，为空时依据 Name 自动生成
+	Case      uint8    // 短文件名项的大小写标志，与 ShortName 一起指定，显示名与 Name 一致时不生成长文件名项
+	Attr      uint8
+	Content   []byte
+	Clusters  []uint32          // 簇号链，为空时构建时顺序分配
+	Offsets   []*DirEntryOffset // 构建后回填：长文件名项与短文件名项的偏移
+	children  []*BuildEntry
+}
+
+// IsDir 是否为目录
+func (e *BuildEntry) IsDir() bool {
+	return e.Attr&0x10 != 0
+}
+
+// NewVolumeBuilder 创建卷构造器，默认2个FAT表、65536个簇
+func NewVolumeBuilder(bytesPerSector uint16, sectorsPerCluster uint8) *VolumeBuilder {
+	return &VolumeBuilder{
+		BytesPerSector:    bytesPerSector,
+		SectorsPerCluster: sectorsPerCluster,
+		ReservedSectors:   32,
+		NumFATs:           2,
+		ClusterCount:      65536,
+		Time:              time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC),
+		CodePage:          DefaultCodePage,
+		root:              &BuildEntry{Attr: 0x10},
+		used:              map[uint32]bool{2: true},
+		next:              3,
+	}
+}
+
+// AddDir 添加目录，父目录不存在时自动创建
+func (b *VolumeBuilder) AddDir(path string) *BuildEntry {
+	return b.add(path, &BuildEntry{Attr: 0x10})
+}
+
+// AddFile 添加文件，簇号链在构建时顺序分配
+func (b *VolumeBuilder) AddFile(path string, content []byte) *BuildEntry {
+	return b.add(path, &BuildEntry{Attr: 0x20, Content: content})
+}
+
+// AddFileAt 添加文件并指定其簇号链，用于构造碎片化文件
+func (b *VolumeBuilder) AddFileAt(path string, content []byte, clusters ...uint32) *BuildEntry {
+	entry := &BuildEntry{Attr: 0x20, Content: content, Clusters: clusters}
+	if len(clusters) != b.clustersFor(len(content)) {
+		b.fail(fmt.Errorf("%s: %d bytes need %d clusters, got %d", path, len(content), b.clustersFor(len(content)), len(clusters)))
+		return entry
+	}
+	for _, cluster := range clusters {
+		if cluster < 2 || cluster >= b.ClusterCount+2 || b.used[cluster] {
+			b.fail(fmt.Errorf("%s: cluster %d unavailable", path, cluster))
+			return entry
+		}
+		b.used[cluster] = true
+	}
+	return b.add(path, entry)
+}
+
+func (b *VolumeBuilder) fail(err error) {
+	if b.err == nil {
+		b.err = err
+	}
+}
+
+func (b *VolumeBuilder) clusterSize() int {
+	return int(b.BytesPerSector) * int(b.SectorsPerCluster)
+}
+
+func (b *VolumeBuilder) clustersFor(size int) int {
+	return (size + b.clusterSize() - 1) / b.clusterSize()
+}
+
+func (b *VolumeBuilder) add(path string, entry *BuildEntry) *BuildEntry {
+	names := strings.Split(strings.Trim(path, "/"), "/")
+	parent := b.root
+	for _, name := range names[:len(names)-1] {
+		child := parent.child(name)
+		if child == nil {
+			child = &BuildEntry{Name: name, Attr: 0x10}
+			parent.children = append(parent.children, child)
+		}
+		if !child.IsDir() {
+			b.fail(fmt.Errorf("%s: %s is not a directory", path, name))
+			return entry
+		}
+		parent = child
+	}
+	entry.Name = names[len(names)-1]
+	if entry.Name == "" || parent.child(entry.Name) != nil {
+		b.fail(fmt.Errorf("%s: invalid or duplicate name", path))
+		return entry
+	}
+	parent.children = append(parent.children, entry)
+	return entry
+}
+
+func (e *BuildEntry) child(name string) *BuildEntry {
+	for _, c := range e.children {
+		if c.Name == name {
+			return c
+		}
+	}
+	return nil
+}
+
+// dirClusters 计算目录需要的簇数，按每个子项均需长文件名项估算
+func (b *VolumeBuilder) dirClusters(dir *BuildEntry) int {
+	n := 2
+	for _, child := range dir.children {
+		n += len(encodeLongName(child.Name, 0)) + 1
+	}
+	return max(b.clustersFor(n*32), 1)
+}
+
+// alloc 顺序分配n个未使用的簇
+func (b *VolumeBuilder) alloc(n int) ([]uint32, error) {
+	var clusters []uint32
+	for len(clusters) < n {
+		if b.next >= b.ClusterCount+2 {
+			return nil, errors.New("volume full")
+		}
+		if !b.used[b.next] {
+			b.used[b.next] = true
+			clusters = append(clusters, b.next)
+		}
+		b.next++
+	}
+	return clusters, nil
+}
+
+// Build 依据已添加的文件与目录生成FAT32卷
+func (b *VolumeBuilder) Build() (*MemDriver, error) {
+	if b.err != nil {
+		return nil, b.err
+	}
+	fatSectors := (uint32(b.ClusterCount+2)*4 + uint32(b.BytesPerSector) - 1) / uint32(b.BytesPerSector)
+	dataStart := uint32(b.ReservedSectors) + uint32(b.NumFATs)*fatSectors
+	totalSectors := dataStart + b.ClusterCount*uint32(b.SectorsPerCluster)
+
+	driver := NewMemDriver(b.BytesPerSector, uint64(totalSectors))
+	fat := make([]uint32, b.ClusterCount+2)
+	fat[0] = 0x0ffffff8
+	fat[1] = 0x0fffffff
+	// 根目录起始于2号簇，目录项较多时追加簇
+	extra, err := b.alloc(b.dirClusters(b.root) - 1)
+	if err != nil {
+		return nil, err
+	}
+	b.root.Clusters = append([]uint32{2}, extra...)
+
+	// 写入簇号链对应的数据
+	writeChain := func(clusters []uint32, content []byte) error {
+		for i, cluster := range clusters {
+			if i+1 < len(clusters) {
+				fat[cluster] = clusters[i+1]
+			} else {
+				fat[cluster] = 0x0fffffff
+			}
+			start := i * b.clusterSize()
+			if start >= len(content) {
+				continue
+			}
+			end := min(start+b.clusterSize(), len(content))
+			sector := uint64(dataStart) + uint64(cluster-2)*uint64(b.SectorsPerCluster)
+			err := driver.WriteData(content[start:end], sector, 0)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	var layout func(dir *BuildEntry, parent uint32) error
+	layout = func(dir *BuildEntry, parent uint32) error {
+		var raw [][]byte
+		var owners []*BuildEntry
+		if dir != b.root {
+			raw = append(raw, b.encodeShort(dirEntryName(".", ""), 0x10, 0, dir.Clusters[0], 0))
+			raw = append(raw, b.encodeShort(dirEntryName("..", ""), 0x10, 0, parent, 0))
+			owners = append(owners, nil, nil)
+		}
+		taken := make(map[[11]byte]bool)
+		for _, child := range dir.children {
+			short, needLFN := child.ShortName, false
+			if short == ([11]byte{}) {
+				short, needLFN = generateShortName(child.Name, taken)
+			} else {
+				needLFN = b.CodePage.shortName(short, child.Case) != child.Name
+			}
+			taken[short] = true
+			if needLFN {
+				for _, lfn := range encodeLongName(child.Name, shortNameChecksum(short)) {
+					raw = append(raw, lfn)
+					owners = append(owners, child)
+				}
+			}
+			// 先分配子项的簇，短文件名项中需要写入起始簇号
+			if child.Clusters == nil {
+				n := b.clustersFor(len(child.Content))
+				if child.IsDir() {
+					n = b.dirClusters(child)
+				}
+				clusters, err := b.alloc(n)
+				if err != nil {
+					return err
+				}
+				child.Clusters = clusters
+			}
+			var start, size uint32
+			if len(child.Clusters) > 0 {
+				start = child.Clusters[0]
+			}
+			if !child.IsDir() {
+				size = uint32(len(child.Content))
+			}
+			raw = append(raw, b.encodeShort(short, child.Attr, child.Case, start, size))
+			owners = append(owners, child)
+		}
+		if len(raw)*32 > len(dir.Clusters)*b.clusterSize() {
+			return fmt.Errorf("%s: directory too small", dir.Name)
+		}
+
+		content := make([]byte, 0, len(raw)*32)
+		for i, entry := range raw {
+			content = append(content, entry...)
+			if owners[i] != nil {
+				offset := i * 32
+				owners[i].Offsets = append(owners[i].Offsets, &DirEntryOffset{
+					ClusterNumber: dir.Clusters[offset/b.clusterSize()],
+					Offset:        uint32(offset % b.clusterSize()),
+				})
+			}
+		}
+		// 目录簇需完整清零，保证目录结束标志存在
+		full := make([]byte, len(dir.Clusters)*b.clusterSize())
+		copy(full, content)
+		err := writeChain(dir.Clusters, full)
+		if err != nil {
+			return err
+		}
+
+		for _, child := range dir.children {
+			if child.IsDir() {
+				self := dir.Clusters[0]
+				if dir == b.root {
+					self = 0
+				}
+				err = layout(child, self)
+			} else {
+				err = writeChain(child.Clusters, child.Content)
+			}
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	err = layout(b.root, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	// 写入所有FAT表副本
+	fatBytes := make([]byte, fatSectors*uint32(b.BytesPerSector))
+	for i, link := range fat {
+		binary.LittleEndian.PutUint32(fatBytes[i*4:], link)
+	}
+	for i := uint32(0); i < uint32(b.NumFATs); i++ {
+		err = driver.WriteData(fatBytes, uint64(uint32(b.ReservedSectors)+i*fatSectors), 0)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// 引导扇区与FSInfo扇区，及其位于6、7扇区的备份
+	boot := b.bootSector(totalSectors, fatSectors)
+	fsInfo := b.fsInfoSector(uint32(len(fat)-2-len(b.used)), b.next)
+	for _, base := range []uint64{0, 6} {
+		if err = driver.WriteData(boot, base, 0); err != nil {
+			return nil, err
+		}
+		if err = driver.WriteData(fsInfo, base+1, 0); err != nil {
+			return nil, err
+		}
+	}
+	return driver, nil
+}
+
+func (b *VolumeBuilder) bootSector(totalSectors, fatSectors uint32) []byte {
+	bpr := FAT32BootSector{
+		JumpInstruction:       [3]byte{0xeb, 0x58, 0x90},
+		OSVersion:             [8]byte{'M', 'S', 'W', 'I', 'N', '4', '.', '1'},
+		BytesPerSector:        b.BytesPerSector,
+		SectorsPerCluster:     b.SectorsPerCluster,
+		ReservedSectors:       b.ReservedSectors,
+		NumFATs:               b.NumFATs,
+		MediaDescriptor:       0xf8,
+		SectorsPerTrack:       63,
+		NumHeads:              255,
+		TotalSectors32:        totalSectors,
+		SectorsPerFAT32:       fatSectors,
+		Flags:                 b.Flags,
+		RootCluster:           2,
+		FSInfoSector:          1,
+		BackupBootSector:      6,
+		BIOSDriveNum:          0x80,
+		ExtendedBootSignature: 0x29,
+		VolumeSerialNumber:    0x12345678,
+	}
+	copy(bpr.VolumeLabel[:], "NO NAME    ")
+	copy(bpr.FileSystemType[:], "FAT32   ")
+	var buf bytes.Buffer
+	_ = binary.Write(&buf, binary.LittleEndian, &bpr)
+	sector := make([]byte, b.BytesPerSector)
+	copy(sector, buf.Bytes())
+	sector[510], sector[511] = 0x55, 0xaa
+	return sector
+}
+
+func (b *VolumeBuilder) fsInfoSector(freeCount, nextFree uint32) []byte {
+	sector := make([]byte, b.BytesPerSector)
+	binary.LittleEndian.PutUint32(sector[0:], 0x41615252)
+	binary.LittleEndian.PutUint32(sector[484:], 0x61417272)
+	binary.LittleEndian.PutUint32(sector[488:], freeCount)
+	binary.LittleEndian.PutUint32(sector[492:], nextFree)
+	binary.LittleEndian.PutUint32(sector[508:], 0xaa550000)
+	return sector
+}
+
+// encodeShort 编码32字节短文件名目录项
+func (b *VolumeBuilder) encodeShort(name [11]byte, attr, caseFlags uint8, cluster uint32, size uint32) []byte {
+	date := uint16(b.Time.Year()-1980)<<9 | uint16(b.Time.Month())<<5 | uint16(b.Time.Day())
+	clock := uint16(b.Time.Hour())<<11 | uint16(b.Time.Minute())<<5 | uint16(b.Time.Second()/2)
+	entry := FAT32DirEntry{
+		FileName:         name,
+		FileAttributes:   attr,
+		CaseFlags:        caseFlags,
+		CreateTime:       clock,
+		CreateDate:       date,
+		LastAccessDate:   date,
+		ClusterHigh:      uint16(cluster >> 16),
+		LastModifiedTime: clock,
+		LastModifiedDate: date,
+		ClusterLow:       uint16(cluster),
+		FileSize:         size,
+	}
+	var buf bytes.Buffer
+	_ = binary.Write(&buf, binary.LittleEndian, &entry)
+	return buf.Bytes()
+}
+
+// dirEntryName 将主文件名与拓展名填充为11字节的目录项文件名
+func dirEntryName(base, ext string) [11]byte {
+	var name [11]byte
+	copy(name[:], fmt.Sprintf("%-8s%-3s", base, ext))
+	return name
+}
+
+// isShortName 判断文件名是否可直接作为大写8.3短文件名存储
+func isShortName(name string) bool {
+	base, ext, found := strings.Cut(name, ".")
+	if base == "" || len(base) > 8 || len(ext) > 3 || (found && ext == "") || strings.Contains(ext, ".") {
+		return false
+	}
+	for _, c := range base + ext {
+		if !isShortNameChar(c) || (c >= 'a' && c <= 'z') {
+			return false
+		}
+	}
+	return true
+}
+
+func isShortNameChar(c rune) bool {
+	return (c >= 'A' && c <= 'Z') || (c >= 'a' && c <= 'z') || (c >= '0' && c <= '9') ||
+		strings.ContainsRune("$%'-_@~`!(){}^#&", c)
+}
+
+// generateShortName 依据长文件名生成短文件名别名，返回是否需要长文件名项
+func generateShortName(name string, taken map[[11]byte]bool) ([11]byte, bool) {
+	if isShortName(name) {
+		base, ext, _ := strings.Cut(name, ".")
+		return dirEntryName(base, ext), false
+	}
+	clean := func(s string, n int) string {
+		var sb strings.Builder
+		for _, c := range strings.ToUpper(s) {
+			if sb.Len() >= n {
+				break
+			}
+			switch {
+			case c == ' ' || c == '.':
+			case c < 0x80 && isShortNameChar(c):
+				sb.WriteRune(c)
+			default:
+				sb.WriteByte('_')
+			}
+		}
+		return sb.String()
+	}
+	base, ext := strings.TrimLeft(name, "."), ""
+	if i := strings.LastIndex(base, "."); i >= 0 {
+		base, ext = base[:i], base[i+1:]
+	}
+	base, ext = clean(base, 6), clean(ext, 3)
+	if base == "" {
+		base = "_"
+	}
+	for n := 1; ; n++ {
+		tail := fmt.Sprintf("~%d", n)
+		short := dirEntryName(base[:min(len(base), 8-len(tail))]+tail, ext)
+		if !taken[short] {
+			return short, true
+		}
+	}
+}
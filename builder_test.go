@@ -0,0 +1,145 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"path/filepath"
+	"testing"
+)
+
+// fill 生成不含0字节的测试内容，保证清零后每个字节都会变化
+func fill(size int, seed byte) []byte {
+	content := make([]byte, size)
+	for i := range content {
+		content[i] = byte(i%251) + seed | 1
+	}
+	return content
+}
+
+// buildVolume 构建合成卷并初始化 Volume
+func buildVolume(t testing.TB, b *VolumeBuilder) (*MemDriver, *Volume) {
+	t.Helper()
+	driver, err := b.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	vol, err := NewVolume(driver)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return driver, vol
+}
+
+// lookup 依据以 / 分隔的路径查找目录项
+func lookup(t testing.TB, vol *Volume, path string) (*FAT32DirEntry, []*DirEntryOffset) {
+	t.Helper()
+	dEntry, dEntryOffset, err := getDirEntry(vol, filepath.FromSlash(path))
+	if err != nil {
+		t.Fatalf("%s: %v", path, err)
+	}
+	return dEntry, dEntryOffset
+}
+
+// clusterAddr 返回簇在卷中的字节地址
+func clusterAddr(vol *Volume, cluster uint32) uint64 {
+	sector := uint64(vol.Offset.Data) + uint64(cluster-2)*uint64(vol.BPRSector.SectorsPerCluster)
+	return sector * uint64(vol.BPRSector.BytesPerSector)
+}
+
+// diffBytes 比较两个内存磁盘，返回所有发生变化的字节地址及其新值
+func diffBytes(before, after *MemDriver) map[uint64]byte {
+	size := uint64(after.BytesPerSector)
+	nums := append(before.Sectors(), after.Sectors()...)
+	diff := make(map[uint64]byte)
+	for _, num := range nums {
+		old, _ := before.ReadSector(num, 1)
+		cur, _ := after.ReadSector(num, 1)
+		for i := range cur {
+			if old[i] != cur[i] {
+				diff[num*size+uint64(i)] = cur[i]
+			}
+		}
+	}
+	return diff
+}
+
+func TestVolumeBuilderLayout(t *testing.T) {
+	b := NewVolumeBuilder(512, 8)
+	report := b.AddFile("docs/reports/Quarterly Report.txt", fill(10000, 3))
+	frag := b.AddFileAt("frag.bin", fill(3*4096, 5), 40, 20, 60)
+	empty := b.AddFile("EMPTY.TXT", nil)
+	driver, vol := buildVolume(t, b)
+
+	dEntry, offsets := lookup(t, vol, "docs/reports/Quarterly Report.txt")
+	if dEntry.FileSize != 10000 {
+		t.Errorf("file size = %d, want 10000", dEntry.FileSize)
+	}
+	if len(offsets) != len(report.Offsets) {
+		t.Errorf("got %d entry offsets, builder recorded %d", len(offsets), len(report.Offsets))
+	}
+	chain, err := followChain(vol, uint32(dEntry.ClusterHigh)<<16|uint32(dEntry.ClusterLow), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(chain) != len(report.Clusters) {
+		t.Errorf("chain %v, want %v", chain, report.Clusters)
+	}
+	buf, _ := driver.ReadSector(clusterAddr(vol, report.Clusters[0])/512, 1)
+	if !bytes.Equal(buf, report.Content[:512]) {
+		t.Error("file content not written to first cluster")
+	}
+
+	dEntry, _ = lookup(t, vol, "frag.bin")
+	chain, err = followChain(vol, uint32(dEntry.ClusterLow), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(chain) != 3 || chain[0] != 40 || chain[1] != 20 || chain[2] != 60 {
+		t.Errorf("fragmented chain = %v, want [40 20 60]", chain)
+	}
+	_ = frag
+
+	dEntry, offsets = lookup(t, vol, "EMPTY.TXT")
+	if dEntry.ClusterLow != 0 || dEntry.FileSize != 0 || len(offsets) != 1 || len(empty.Offsets) != 1 {
+		t.Errorf("empty file entry = %+v, offsets %d", dEntry, len(offsets))
+	}
+
+	// 长文件名项的校验和需与短文件名一致
+	lfn, _ := driver.ReadSector(clusterAddr(vol, report.Offsets[0].ClusterNumber)/512, 1)
+	var lDEntry FAT32LongDirEntry
+	_ = binary.Read(bytes.NewReader(lfn[report.Offsets[0].Offset:]), binary.LittleEndian, &lDEntry)
+	sfn, _ := driver.ReadSector(clusterAddr(vol, report.Offsets[len(report.Offsets)-1].ClusterNumber)/512, 1)
+	var name [11]byte
+	copy(name[:], sfn[report.Offsets[len(report.Offsets)-1].Offset:])
+	if lDEntry.Checksum != shortNameChecksum(name) {
+		t.Errorf("lfn checksum %#x, want %#x for %q", lDEntry.Checksum, shortNameChecksum(name), name)
+	}
+
+	fsInfo, _ := driver.ReadSector(uint64(vol.BPRSector.FSInfoSector), 1)
+	free := binary.LittleEndian.Uint32(fsInfo[488:])
+	if want := b.ClusterCount - uint32(len(b.used)); free != want {
+		t.Errorf("fsinfo free count = %d, want %d", free, want)
+	}
+}
+
+func TestGenerateShortName(t *testing.T) {
+	taken := make(map[[11]byte]bool)
+	tests := []struct {
+		name    string
+		short   string
+		needLFN bool
+	}{
+		{"README.TXT", "README  TXT", false},
+		{"readme.txt", "README~1TXT", true},
+		{"Quarterly Report.docx", "QUARTE~1DOC", true},
+		{"Quarterly Review.docx", "QUARTE~2DOC", true},
+		{".bashrc", "BASHRC~1   ", true},
+	}
+	for _, tt := range tests {
+		short, needLFN := generateShortName(tt.name, taken)
+		taken[short] = true
+		if string(short[:]) != tt.short || needLFN != tt.needLFN {
+			t.Errorf("generateShortName(%q) = %q, %v; want %q, %v", tt.name, short, needLFN, tt.short, tt.needLFN)
+		}
+	}
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+)
+
+const (
+	fatEntryMask  = 0x0fffffff // FAT32表项只使用低28位，高4位保留
+	fatBadCluster = 0x0ffffff7 // 坏簇标记
+	fatEndOfChain = 0x0ffffff8 // 不小于该值的表项为簇链结束标记
+)
+
+// 簇链损坏的原因
+const (
+	chainCycle       = "cycle"
+	chainOutOfRange  = "link out of range"
+	chainBadCluster  = "link to bad cluster"
+	chainFreeCluster = "link to free cluster"
+	chainTooLong     = "longer than file size"
+)
+
+// ChainError 簇链损坏，Chain 为损坏处之前已确认的簇
+type ChainError struct {
+	Start   uint32   // 簇链的起始簇
+	Cluster uint32   // 表项损坏的簇，起始簇本身无效时为0
+	Next    uint32   // 损坏的表项值，已去掉高4位
+	Reason  string   // 损坏原因
+	Chain   []uint32 // 损坏处之前的簇，按簇链顺序
+}
+
+func (e *ChainError) Error() string {
+	return fmt.Sprintf("cluster chain from %d is corrupt: %s at cluster %d (entry %#x) after %d clusters",
+		e.Start, e.Reason, e.Cluster, e.Next, len(e.Chain))
+}
+
+// followChain 沿FAT表从 start 开始读取簇链，返回的簇链不含结束标记
+// 簇链出现环、指向数据区之外、坏簇或空闲簇，或超过 limit 个簇时返回 ChainError；limit 为0时以卷的簇数为上限
+func followChain(vol *Volume, start uint32, limit int) ([]uint32, error) {
+	end := vol.ClusterCount() + 2
+	if limit <= 0 || limit > int(vol.ClusterCount()) {
+		limit = int(vol.ClusterCount())
+	}
+	var chain []uint32
+	corrupt := func(reason string, cluster, next uint32) error {
+		return &ChainError{Start: start, Cluster: cluster, Next: next, Reason: reason, Chain: chain}
+	}
+	if start < 2 || start >= end {
+		return nil, corrupt(chainOutOfRange, 0, start)
+	}
+
+	visited := make(map[uint32]bool)
+	for cluster := start; ; {
+		visited[cluster] = true
+		chain = append(chain, cluster)
+		entry, err := readFATEntry(vol, cluster)
+		if err != nil {
+			return nil, err
+		}
+		next := entry & fatEntryMask
+		switch {
+		case next >= fatEndOfChain:
+			return chain, nil
+		case next == fatBadCluster:
+			return chain, corrupt(chainBadCluster, cluster, next)
+		case next == 0:
+			return chain, corrupt(chainFreeCluster, cluster, next)
+		case next < 2 || next >= end:
+			return chain, corrupt(chainOutOfRange, cluster, next)
+		case visited[next]:
+			return chain, corrupt(chainCycle, cluster, next)
+		case len(chain) >= limit:
+			return chain, corrupt(chainTooLong, cluster, next)
+		}
+		cluster = next
+	}
+}
+
+// clustersFor 返回存放 size 字节需要的簇数
+func clustersFor(vol *Volume, size uint32) int {
+	clusterBytes := uint64(vol.BPRSector.BytesPerSector) * uint64(vol.BPRSector.SectorsPerCluster)
+	return int((uint64(size) + clusterBytes - 1) / clusterBytes)
+}
+
+// removeChain 返回删除文件时需要覆写并释放的簇，按簇号排序
+// 文件的簇链长度以文件大小为上限；簇链损坏时返回 ChainError，开启 salvage 时只保留可以安全覆写的部分
+func removeChain(vol *Volume, opts *RemoveOptions, dEntry *FAT32DirEntry) ([]uint32, error) {
+	start := uint32(dEntry.ClusterHigh)<<16 | uint32(dEntry.ClusterLow)
+	if start == 0 {
+		return nil, nil
+	}
+	limit := 0
+	if dEntry.FileAttributes&0x10 == 0 {
+		limit = max(clustersFor(vol, dEntry.FileSize), 1)
+	}
+	chain, err := followChain(vol, start, limit)
+	var chainErr *ChainError
+	if err != nil {
+		if !opts.Salvage || !errors.As(err, &chainErr) {
+			return nil, err
+		}
+		chain, err = salvageChain(vol, chainErr)
+		if err != nil {
+			return nil, err
+		}
+		log.Printf("Warning: %v; salvaging %d clusters, the rest stay allocated until a file system check", chainErr, len(chain))
+	}
+	sort.Slice(chain, func(i, j int) bool {
+		return chain[i] < chain[j]
+	})
+	return chain, nil
+}
+
+// salvageChain 返回损坏簇链中可以安全覆写的簇
+// 扫描整个FAT表，若簇链之外的簇指向链中某簇，说明该簇及之后的簇与其他文件交叉链接，不能覆写
+func salvageChain(vol *Volume, chainErr *ChainError) ([]uint32, error) {
+	chain := chainErr.Chain
+	inChain := make(map[uint32]int, len(chain))
+	for i, cluster := range chain {
+		inChain[cluster] = i
+	}
+	safe := len(chain)
+	end := vol.ClusterCount() + 2
+	for cluster := uint32(2); cluster < end && safe > 0; cluster++ {
+		if _, ok := inChain[cluster]; ok {
+			continue
+		}
+		entry, err := readFATEntry(vol, cluster)
+		if err != nil {
+			return nil, err
+		}
+		if i, ok := inChain[entry&fatEntryMask]; ok && i < safe {
+			safe = i
+		}
+	}
+	return chain[:safe], nil
+}
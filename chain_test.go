@@ -0,0 +1,168 @@
+package main
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// writeFATRaw 经FAT表缓存写入所有FAT表副本中的表项，包括高4位
+func writeFATRaw(t *testing.T, vol *Volume, cluster, value uint32) {
+	t.Helper()
+	err := vol.fat.set(vol, cluster, value)
+	if err == nil {
+		err = vol.fat.flush(vol)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFollowChain(t *testing.T) {
+	for _, c := range []struct {
+		name   string
+		link   uint32 // 写入第2个簇的表项
+		limit  int
+		reason string
+		chain  []uint32
+	}{
+		{"ok", 0xf0000000 | 12, 0, "", []uint32{10, 11, 12}},
+		{"end with reserved bits", 0xf0000000 | fatEndOfChain, 0, "", []uint32{10, 11}},
+		{"cycle", 10, 0, chainCycle, []uint32{10, 11}},
+		{"self loop", 11, 0, chainCycle, []uint32{10, 11}},
+		{"bad cluster", fatBadCluster, 0, chainBadCluster, []uint32{10, 11}},
+		{"free cluster", 0xf0000000, 0, chainFreeCluster, []uint32{10, 11}},
+		{"out of range", 0x0ffffff0, 0, chainOutOfRange, []uint32{10, 11}},
+		{"reserved cluster", 1, 0, chainOutOfRange, []uint32{10, 11}},
+		{"too long", 12, 2, chainTooLong, []uint32{10, 11}},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			b := NewVolumeBuilder(512, 1)
+			b.AddFileAt("a.bin", fill(1500, 1), 10, 11, 12)
+			_, vol := buildVolume(t, b)
+			writeFATRaw(t, vol, 11, c.link)
+
+			chain, err := followChain(vol, 10, c.limit)
+			var chainErr *ChainError
+			switch {
+			case c.reason == "" && err != nil:
+				t.Fatal(err)
+			case c.reason != "" && !errors.As(err, &chainErr):
+				t.Fatalf("got %v, want %s", err, c.reason)
+			case c.reason != "":
+				if chainErr.Reason != c.reason || chainErr.Start != 10 || chainErr.Cluster != 11 || chainErr.Next != c.link&fatEntryMask {
+					t.Errorf("got %+v, want %s at cluster 11", chainErr, c.reason)
+				}
+				chain = chainErr.Chain
+			}
+			if !reflect.DeepEqual(chain, c.chain) {
+				t.Errorf("chain %v, want %v", chain, c.chain)
+			}
+		})
+	}
+
+	b := NewVolumeBuilder(512, 1)
+	_, vol := buildVolume(t, b)
+	var chainErr *ChainError
+	if _, err := followChain(vol, vol.ClusterCount()+2, 0); !errors.As(err, &chainErr) || chainErr.Reason != chainOutOfRange {
+		t.Errorf("start out of range: %v", err)
+	}
+}
+
+func TestRemoveCorruptChain(t *testing.T) {
+	b := NewVolumeBuilder(512, 1)
+	victim := b.AddFileAt("victim.bin", fill(2000, 1), 10, 11, 12, 13)
+	other := b.AddFileAt("other.bin", fill(1500, 2), 20, 21, 22)
+	long := b.AddFileAt("long.bin", fill(100, 3), 30)
+	_, vol := buildVolume(t, b)
+	// victim 的簇链在13处成环回到11，other 的簇链在21之后交叉链接到13
+	writeFATRaw(t, vol, 13, 11)
+	writeFATRaw(t, vol, 21, 13)
+	// long 只有一个簇的大小，簇链却指向40
+	writeFATRaw(t, vol, 30, 40)
+	writeFATRaw(t, vol, 40, fatEndOfChain)
+
+	wiper, _ := NewWiper(WipeProfiles["zero"], nil)
+	for _, entry := range []*BuildEntry{victim, long} {
+		dEntry, offsets := lookup(t, vol, entry.Name)
+		before := vol.Driver.(*MemDriver).Clone()
+		err := doRemoveFile(vol, &RemoveOptions{Wiper: wiper}, entry.Name, dEntry, offsets)
+		var chainErr *ChainError
+		if !errors.As(err, &chainErr) {
+			t.Fatalf("%s: got %v, want ChainError", entry.Name, err)
+		}
+		if diff := diffBytes(before, vol.Driver.(*MemDriver)); len(diff) != 0 {
+			t.Errorf("%s: %d bytes written before the chain was checked", entry.Name, len(diff))
+		}
+	}
+
+	// 只覆写并释放交叉链接之前的簇，13与 other 的簇保持不变
+	dEntry, offsets := lookup(t, vol, "victim.bin")
+	err := doRemoveFile(vol, &RemoveOptions{Wiper: wiper, Salvage: true}, "victim.bin", dEntry, offsets)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, cluster := range []uint32{10, 11, 12} {
+		if entry, _ := readFATEntry(vol, cluster); entry != 0 {
+			t.Errorf("cluster %d not freed: %#x", cluster, entry)
+		}
+		if buf := readCluster(t, vol, cluster); buf[0] != 0 {
+			t.Errorf("cluster %d not wiped", cluster)
+		}
+	}
+	if entry, _ := readFATEntry(vol, 13); entry != 11 {
+		t.Errorf("shared cluster 13 changed: %#x", entry)
+	}
+	if buf := readCluster(t, vol, 13); buf[0] != victim.Content[3*512] {
+		t.Error("shared cluster 13 wiped")
+	}
+	for i, cluster := range other.Clusters {
+		if buf := readCluster(t, vol, cluster); buf[0] != other.Content[i*512] {
+			t.Errorf("other.bin cluster %d wiped", cluster)
+		}
+	}
+	if _, _, err := getDirEntry(vol, "victim.bin"); err == nil {
+		t.Error("victim.bin still found")
+	}
+
+	// 超出文件大小的部分不覆写
+	dEntry, offsets = lookup(t, vol, "long.bin")
+	err = doRemoveFile(vol, &RemoveOptions{Wiper: wiper, Salvage: true}, "long.bin", dEntry, offsets)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entry, _ := readFATEntry(vol, 30); entry != 0 {
+		t.Errorf("cluster 30 not freed: %#x", entry)
+	}
+	if entry, _ := readFATEntry(vol, 40); entry&fatEntryMask != fatEndOfChain {
+		t.Errorf("cluster 40 beyond file size changed: %#x", entry)
+	}
+}
+
+func TestRemoveCorruptChainKeepsVolumeClean(t *testing.T) {
+	b := NewVolumeBuilder(512, 1)
+	b.AddFileAt("dir/a.txt", fill(100, 1), 20)
+	b.AddFileAt("dir/victim.bin", fill(1500, 2), 10, 11, 12)
+	mem, vol := buildVolume(t, b)
+	writeFATRaw(t, vol, 12, 10)
+	before := mem.Clone()
+
+	// 目录中任一文件的簇链损坏时，所有文件都不删除，卷不被标记为脏
+	wiper, _ := NewWiper(WipeProfiles["zero"], nil)
+	err := removeFromVolume(vol, &RemoveOptions{Wiper: wiper}, "dir", "dir")
+	var chainErr *ChainError
+	if !errors.As(err, &chainErr) {
+		t.Fatalf("got %v, want ChainError", err)
+	}
+	if diff := diffBytes(before, mem); len(diff) != 0 {
+		t.Errorf("%d bytes written before the chains were checked", len(diff))
+	}
+
+	err = removeFromVolume(vol, &RemoveOptions{Wiper: wiper, Salvage: true}, "dir", "dir")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := getDirEntry(vol, "dir"); err == nil {
+		t.Error("dir still present after salvage")
+	}
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/japanese"
+	"golang.org/x/text/encoding/korean"
+	"golang.org/x/text/encoding/simplifiedchinese"
+	"golang.org/x/text/encoding/traditionalchinese"
+	"sort"
+	"strings"
+)
+
+// CodePage 短文件名使用的OEM代码页，与 Linux vfat 的 codepage= 挂载选项对应
+type CodePage struct {
+	Name string
+	enc  encoding.Encoding
+}
+
+// CodePages 支持的代码页，以代码页编号为键
+var CodePages = map[string]encoding.Encoding{
+	"437": charmap.CodePage437,
+	"850": charmap.CodePage850,
+	"852": charmap.CodePage852,
+	"855": charmap.CodePage855,
+	"858": charmap.CodePage858,
+	"860": charmap.CodePage860,
+	"862": charmap.CodePage862,
+	"863": charmap.CodePage863,
+	"865": charmap.CodePage865,
+	"866": charmap.CodePage866,
+	"874": charmap.Windows874,
+	"932": japanese.ShiftJIS,
+	"936": simplifiedchinese.GBK,
+	"949": korean.EUCKR,
+	"950": traditionalchinese.Big5,
+}
+
+// DefaultCodePage 默认代码页，与 Linux vfat 的默认值一致
+var DefaultCodePage = &CodePage{Name: "437", enc: charmap.CodePage437}
+
+// CodePageNames 返回所有支持的代码页编号
+func CodePageNames() []string {
+	names := make([]string, 0, len(CodePages))
+	for name := range CodePages {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ParseCodePage 依据代码页编号创建代码页，可带 "cp" 前缀
+func ParseCodePage(name string) (*CodePage, error) {
+	name = strings.TrimPrefix(strings.ToLower(name), "cp")
+	enc, ok := CodePages[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown code page %q, supported: %s", name, strings.Join(CodePageNames(), ", "))
+	}
+	return &CodePage{Name: name, enc: enc}, nil
+}
+
+func (cp *CodePage) String() string {
+	return "cp" + cp.Name
+}
+
+// isASCII 判断字节序列是否只含ASCII字符，此时无需转换
+func isASCII(b []byte) bool {
+	for _, c := range b {
+		if c >= 0x80 {
+			return false
+		}
+	}
+	return true
+}
+
+// decode 将代码页编码的字节转换为字符串，无法转换的字节替换为 U+FFFD
+func (cp *CodePage) decode(b []byte) string {
+	if isASCII(b) {
+		return string(b)
+	}
+	s, err := cp.enc.NewDecoder().Bytes(b)
+	if err != nil {
+		return strings.ToValidUTF8(string(b), "�")
+	}
+	return string(s)
+}
+
+// encode 将字符串转换为代码页编码，含有代码页中不存在的字符时返回false
+func (cp *CodePage) encode(s string) ([]byte, bool) {
+	if isASCII([]byte(s)) {
+		return []byte(s), true
+	}
+	b, err := cp.enc.NewEncoder().Bytes([]byte(s))
+	if err != nil {
+		return nil, false
+	}
+	return b, true
+}
+
+// shortName 将11字节的短文件名转换为 "主文件名.拓展名" 的形式，按大小写标志转换为小写
+func (cp *CodePage) shortName(name [11]byte, caseFlags uint8) string {
+	// 首字节0xE5以0x05代替，避免与删除标记混淆
+	if name[0] == 0x05 {
+		name[0] = 0xe5
+	}
+	base := cp.decode(bytes.TrimRight(name[:8], " "))
+	ext := cp.decode(bytes.TrimRight(name[8:], " "))
+	if caseFlags&caseLowerBase != 0 {
+		base = strings.ToLower(base)
+	}
+	if caseFlags&caseLowerExt != 0 {
+		ext = strings.ToLower(ext)
+	}
+	if ext == "" {
+		return base
+	}
+	return base + "." + ext
+}
+
+// packShortName 将文件名按8.3格式转换为大写并以代码页编码，填充为11字节的目录项文件名
+// 不符合8.3格式或含有代码页中不存在的字符时返回false
+func (cp *CodePage) packShortName(fileName string) ([11]byte, bool) {
+	var name [11]byte
+	base, ext := fileName, ""
+	if i := strings.LastIndexByte(fileName, '.'); i >= 0 {
+		base, ext = fileName[:i], fileName[i+1:]
+	}
+	if base == "" || strings.ContainsRune(base, '.') {
+		return name, false
+	}
+	// 短文件名以大写存储，大写字符不在代码页中时保留原字符
+	upper := func(s string) ([]byte, bool) {
+		if b, ok := cp.encode(strings.ToUpper(s)); ok {
+			return b, true
+		}
+		return cp.encode(s)
+	}
+	baseBytes, ok := upper(base)
+	if !ok || len(baseBytes) > 8 {
+		return name, false
+	}
+	extBytes, ok := upper(ext)
+	if !ok || len(extBytes) > 3 {
+		return name, false
+	}
+	copy(name[:], bytes.Repeat([]byte{' '}, 11))
+	copy(name[:8], baseBytes)
+	copy(name[8:], extBytes)
+	if name[0] == 0xe5 {
+		name[0] = 0x05
+	}
+	return name, true
+}
+
+// fileNameEqual 短文件名目录项比较，短文件名以大写存储，比较时不区分大小写
+func (cp *CodePage) fileNameEqual(dEntryName [11]byte, fileName string) bool {
+	name, ok := cp.packShortName(fileName)
+	return ok && name == dEntryName
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseCodePage(t *testing.T) {
+	for _, name := range []string{"437", "cp850", "CP936"} {
+		if _, err := ParseCodePage(name); err != nil {
+			t.Errorf("%s: %v", name, err)
+		}
+	}
+	if _, err := ParseCodePage("1234"); err == nil {
+		t.Error("unknown code page accepted")
+	}
+}
+
+func TestCodePageShortNames(t *testing.T) {
+	gbk, _ := ParseCodePage("936")
+	cp850, _ := ParseCodePage("850")
+	for _, c := range []struct {
+		cp    *CodePage
+		name  string
+		short [11]byte
+		query string
+	}{
+		{gbk, "报告.TXT", [11]byte{0xb1, 0xa8, 0xb8, 0xe6, ' ', ' ', ' ', ' ', 'T', 'X', 'T'}, "报告.txt"},
+		// 首字节0xE5以0x05存储，GBK中为 "逍" 的首字节
+		{gbk, "逍遥.DOC", [11]byte{0x05, 0xd0, 0xd2, 0xa3, ' ', ' ', ' ', ' ', 'D', 'O', 'C'}, "逍遥.doc"},
+		{cp850, "SMØR.TXT", [11]byte{'S', 'M', 0x9d, 'R', ' ', ' ', ' ', ' ', 'T', 'X', 'T'}, "smør.txt"},
+	} {
+		b := NewVolumeBuilder(512, 1)
+		b.CodePage = c.cp
+		entry := b.AddFile(c.name, fill(100, 1))
+		entry.ShortName = c.short
+		_, vol := buildVolume(t, b)
+		if len(entry.Offsets) != 1 {
+			t.Fatalf("%s: long name entries written", c.name)
+		}
+
+		// 默认代码页下无法按文件名找到
+		if _, _, err := getDirEntry(vol, c.query); err == nil {
+			t.Errorf("%s: found with %s", c.query, vol.CodePage)
+		}
+		vol.CodePage = c.cp
+		_, offsets, err := getDirEntry(vol, c.query)
+		if err != nil {
+			t.Errorf("%s: %v", c.query, err)
+		} else if !reflect.DeepEqual(offsets, entry.Offsets) {
+			t.Errorf("%s: wrong entry", c.query)
+		}
+		items, err := listDir(vol, vol.BPRSector.RootCluster)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(items) != 1 || items[0].Name != c.name {
+			t.Errorf("%s listed as %q", c.name, items[0].Name)
+		}
+	}
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+)
+
+// CompactResult 目录整理的结果
+type CompactResult struct {
+	Entries int      // 保留的目录项数，包括长文件名项
+	Removed int      // 清除的已删除项与孤立长文件名项
+	Moved   int      // 位置发生变化的目录项数
+	Freed   []uint32 // 释放并覆写的目录簇
+}
+
+// compactDir 将目录中的有效目录项连同其长文件名项前移，目录末尾清零，
+// 不再需要的目录簇在覆写后释放
+func compactDir(vol *Volume, opts *RemoveOptions, dirCluster uint32) (*CompactResult, error) {
+	it, err := newDirIterator(vol, dirCluster)
+	if err != nil {
+		return nil, err
+	}
+	chain, old := it.chain, it.dir
+	clusterBytes := int(vol.BPRSector.BytesPerSector) * int(vol.BPRSector.SectorsPerCluster)
+
+	// 依次收集有效目录项，长文件名项与其后的短文件名项作为整体移动，无效的长文件名项不再保留
+	result := &CompactResult{}
+	packed := make([]byte, len(old))
+	n := 0
+	for it.Next() {
+		item := it.Item()
+		if item.pos != n {
+			result.Moved += len(item.Offsets)
+		}
+		n += copy(packed[n:], old[item.pos:item.pos+len(item.Offsets)*32])
+	}
+	if it.Err() != nil {
+		return nil, it.Err()
+	}
+	result.Entries = n / 32
+	result.Removed = it.end/32 - result.Entries
+
+	// 写回保留的目录簇中发生变化的扇区
+	keep := max(1, (n+clusterBytes-1)/clusterBytes)
+	err = writeDir(vol, chain, old[:keep*clusterBytes], packed[:keep*clusterBytes])
+	if err != nil {
+		return nil, err
+	}
+	if keep == len(chain) {
+		return result, nil
+	}
+
+	// 覆写并释放多余的目录簇，最后一个保留簇成为簇链末尾
+	freed := append([]uint32(nil), chain[keep:]...)
+	err = cleanFileContent(vol, opts, freed)
+	if err != nil {
+		return nil, err
+	}
+	err = setFATEntry(vol, chain[keep-1], 0x0fffffff)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(freed, func(i, j int) bool {
+		return freed[i] < freed[j]
+	})
+	err = rmFAT32Link(vol, freed)
+	if err != nil {
+		return nil, err
+	}
+	result.Freed = freed
+	return result, nil
+}
+
+// resolveDir 返回卷内目录的起始簇，路径为空时为根目录
+func resolveDir(vol *Volume, dirPath string) (uint32, error) {
+	if dirPath == "" {
+		return vol.BPRSector.RootCluster, nil
+	}
+	dEntry, _, err := getDirEntry(vol, dirPath)
+	if err != nil {
+		return 0, err
+	}
+	if dEntry.FileAttributes&0x10 == 0 {
+		return 0, fmt.Errorf("%s is not a directory", dirPath)
+	}
+	return uint32(dEntry.ClusterHigh)<<16 | uint32(dEntry.ClusterLow), nil
+}
+
+// CompactDir 整理镜像文件或未挂载设备中的目录，target 为相对于卷根目录的路径
+// 挂载的文件系统按目录项位置缓存打开的文件，移动目录项后内核回写会破坏目录，因此拒绝操作挂载的卷
+func CompactDir(image, target string, opts *RemoveOptions) error {
+	if image == "" {
+		return errors.New("compact moves directory entries the mounted file system still refers to; unmount the volume and pass the device or image with --image")
+	}
+	driver, vol, _, err := openPlanTarget(image, target, false)
+	if err != nil {
+		return err
+	}
+	defer driver.DDestroy()
+
+	if opts.CodePage != nil {
+		vol.CodePage = opts.CodePage
+	}
+	dirPath, err := volumePath(image, target, "")
+	if err != nil {
+		return err
+	}
+	dirCluster, err := resolveDir(vol, dirPath)
+	if err != nil {
+		return err
+	}
+	if opts.Verify {
+		vol.Verifier = NewVerifier()
+	}
+	err = checkClean(vol, opts.Force)
+	if err != nil {
+		return err
+	}
+	err = markDirty(vol)
+	if err != nil {
+		return err
+	}
+
+	result, err := compactDir(vol, opts, dirCluster)
+	if err != nil {
+		return err
+	}
+	err = markClean(vol)
+	if err != nil {
+		return err
+	}
+	if vol.Verifier != nil {
+		err = vol.Verifier.Check(vol.Driver)
+		if err != nil {
+			return err
+		}
+	}
+	log.Printf("Compacted %s: %d entries kept, %d moved, %d deleted or orphaned entries removed, %d clusters freed",
+		target, result.Entries, result.Moved, result.Removed, len(result.Freed))
+	return nil
+}
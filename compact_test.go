@@ -0,0 +1,92 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestCompactDir(t *testing.T) {
+	b := NewVolumeBuilder(512, 1)
+	dir := b.AddDir("photos")
+	var files []*BuildEntry
+	var paths []string
+	for i := 0; i < 40; i++ {
+		paths = append(paths, fmt.Sprintf("photos/Holiday Picture %02d.jpeg", i))
+		files = append(files, b.AddFile(paths[i], fill(600, byte(i))))
+	}
+	_, vol := buildVolume(t, b)
+	dirCluster := uint32(dir.Clusters[0])
+	before, err := dirChain(vol, dirCluster)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	kept := map[int]bool{3: true, 17: true, 38: true}
+	for i, path := range paths {
+		if !kept[i] {
+			removePath(t, vol, path)
+		}
+	}
+	wiper, _ := NewWiper(WipeProfiles["zero"], nil)
+	result, err := compactDir(vol, &RemoveOptions{Wiper: wiper}, dirCluster)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// "." 与 ".." 加上每个保留文件的短文件名项与两个长文件名项
+	if result.Entries != 2+3*3 {
+		t.Errorf("kept %d entries, want %d", result.Entries, 2+3*3)
+	}
+	if result.Removed != 37*3 {
+		t.Errorf("removed %d entries, want %d", result.Removed, 37*3)
+	}
+	after, err := dirChain(vol, dirCluster)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(after) != 1 || len(result.Freed) != len(before)-1 {
+		t.Fatalf("chain %v -> %v, freed %v", before, after, result.Freed)
+	}
+	for _, cluster := range result.Freed {
+		if entry, _ := readFATEntry(vol, cluster); entry != 0 {
+			t.Errorf("cluster %d not freed: %#x", cluster, entry)
+		}
+		if !bytes.Equal(readCluster(t, vol, cluster), make([]byte, 512)) {
+			t.Errorf("cluster %d not wiped", cluster)
+		}
+	}
+
+	// 保留的文件仍可查找且内容不变，目录末尾全部清零
+	for i := range kept {
+		dEntry, _ := lookup(t, vol, paths[i])
+		cluster := uint32(dEntry.ClusterHigh)<<16 | uint32(dEntry.ClusterLow)
+		if cluster != files[i].Clusters[0] || dEntry.FileSize != 600 {
+			t.Errorf("%s: cluster %d size %d after compact", paths[i], cluster, dEntry.FileSize)
+		}
+	}
+	buf := readCluster(t, vol, dirCluster)
+	if !bytes.Equal(buf[result.Entries*32:], make([]byte, 512-result.Entries*32)) {
+		t.Error("directory tail not zeroed")
+	}
+	if _, _, err := getDirEntry(vol, paths[0]); err == nil {
+		t.Errorf("%s found after compact", paths[0])
+	}
+
+	// 再次整理不应有任何变化
+	result, err = compactDir(vol, &RemoveOptions{Wiper: wiper}, dirCluster)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Moved != 0 || result.Removed != 0 || len(result.Freed) != 0 {
+		t.Errorf("second compact changed directory: %+v", result)
+	}
+}
+
+func TestCompactDirRefusesMounted(t *testing.T) {
+	err := CompactDir("", "/mnt/usb/photos", &RemoveOptions{})
+	if err == nil || !strings.Contains(err.Error(), "--image") {
+		t.Fatalf("error = %v, want refusal of a mounted volume", err)
+	}
+}
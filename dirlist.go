@@ -0,0 +1,462 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"log"
+	"path/filepath"
+	"time"
+	"unicode/utf16"
+)
+
+// DirItem 目录中的一个文件、子目录或卷标
+type DirItem struct {
+	Name      string // 显示的文件名，为 NFC 形式的长文件名，没有有效的长文件名时为短文件名
+	LongName  string // 校验通过的长文件名，保持磁盘上的形式，没有时为空
+	ShortName string // 按代码页与大小写标志解码的短文件名
+	Entry     FAT32DirEntry
+	Offsets   []*DirEntryOffset // 长文件名项与短文件名项的位置，短文件名项在最后
+	pos       int               // 第一个目录项在目录内容中的字节位置
+}
+
+// cluster 返回文件的起始簇号
+func (item *DirItem) cluster() uint32 {
+	return uint32(item.Entry.ClusterHigh)<<16 | uint32(item.Entry.ClusterLow)
+}
+
+// isLabel 是否为卷标目录项
+func (item *DirItem) isLabel() bool {
+	return item.Entry.FileAttributes&0x18 == 0x08
+}
+
+// isDot 是否为子目录中的 "." 或 ".." 目录项
+func (item *DirItem) isDot() bool {
+	return item.Entry.FileName[0] == '.'
+}
+
+// isDeleted 是否为已删除的目录项，只在迭代器返回已删除项时出现
+func (item *DirItem) isDeleted() bool {
+	return item.Entry.FileName[0] == 0xe5
+}
+
+// fatTime 解码目录项中的日期与时间，日期无效时返回零值
+func fatTime(date, clock uint16) time.Time {
+	month, day := time.Month(date>>5&0x0f), int(date&0x1f)
+	if month < 1 || month > 12 || day < 1 {
+		return time.Time{}
+	}
+	return time.Date(1980+int(date>>9), month, day, int(clock>>11), int(clock>>5&0x3f), int(clock&0x1f)*2, 0, time.UTC)
+}
+
+// Created 返回创建时间，包括以10毫秒为单位的精确部分
+func (item *DirItem) Created() time.Time {
+	created := fatTime(item.Entry.CreateDate, item.Entry.CreateTime)
+	if created.IsZero() {
+		return created
+	}
+	return created.Add(time.Duration(item.Entry.CreateTimeFine) * 10 * time.Millisecond)
+}
+
+// Modified 返回最后修改时间
+func (item *DirItem) Modified() time.Time {
+	return fatTime(item.Entry.LastModifiedDate, item.Entry.LastModifiedTime)
+}
+
+// MalformedRun 无法归属到短文件名项的长文件名项序列
+type MalformedRun struct {
+	Offsets []*DirEntryOffset
+	Reason  string
+	pos     int // 第一个长文件名项在目录内容中的字节位置
+}
+
+func (run *MalformedRun) String() string {
+	first := run.Offsets[0]
+	return fmt.Sprintf("%d long name entries at cluster %d offset %d: %s", len(run.Offsets), first.ClusterNumber, first.Offset, run.Reason)
+}
+
+// lfnRun 解析中的长文件名项序列
+type lfnRun struct {
+	start   int // 第一个长文件名项的字节位置
+	offsets []*DirEntryOffset
+	ord     byte // 最后一个长文件名项的序号，后续项依次减一
+	sum     byte // 第一个长文件名项中的校验和
+	deleted bool // 已删除的长文件名项，序号被删除标记覆盖，只比较校验和
+	reason  string
+}
+
+// dirIterator 依次返回目录中的短文件名项及其长文件名，遇到目录结束标志0x00时停止
+// 长文件名项需序号连续、以序号1结束且校验和与短文件名一致，否则记录在 Malformed 中，短文件名项单独返回
+// deleted 为真时同时返回已删除的短文件名项，之前校验和一致的已删除长文件名项作为其长文件名
+type dirIterator struct {
+	vol       *Volume
+	chain     []uint32
+	dir       []byte
+	pos       int // 下一个待解析目录项的字节位置
+	end       int // 目录结束标志的字节位置，没有时为目录长度
+	done      bool
+	deleted   bool // 同时返回已删除的短文件名项
+	item      *DirItem
+	err       error
+	Malformed []*MalformedRun
+}
+
+// newDirIterator 读取目录内容并创建迭代器
+func newDirIterator(vol *Volume, dirCluster uint32) (*dirIterator, error) {
+	chain, dir, err := readDir(vol, dirCluster)
+	if err != nil {
+		return nil, err
+	}
+	return &dirIterator{vol: vol, chain: chain, dir: dir, end: len(dir)}, nil
+}
+
+// Next 解析下一个短文件名项，没有更多目录项或出错时返回false
+func (it *dirIterator) Next() bool {
+	it.item = nil
+	if it.done {
+		return false
+	}
+	var run *lfnRun
+	malformed := func(reason string) {
+		if run != nil {
+			if run.reason != "" {
+				reason = run.reason
+			}
+			it.Malformed = append(it.Malformed, &MalformedRun{Offsets: run.offsets, Reason: reason, pos: run.start})
+		}
+		run = nil
+	}
+	for ; it.pos+32 <= len(it.dir); it.pos += 32 {
+		i := it.pos
+		entry := it.dir[i : i+32]
+		offset := dirEntryOffset(it.vol, it.chain, i)
+		if entry[0] == 0 {
+			it.end = i
+			break
+		}
+		if entry[0] == 0xe5 && (!it.deleted || scrubbed(entry)) {
+			malformed("followed by a deleted entry")
+			continue
+		}
+		if entry[0] == 0xe5 && entry[11]&0x3f == 0x0f {
+			// 已删除的长文件名项序号被覆盖，连续且校验和相同的项视为同一序列
+			if run == nil || !run.deleted {
+				malformed("followed by a deleted entry")
+				run = &lfnRun{start: i, sum: entry[13], deleted: true}
+			} else if entry[13] != run.sum {
+				run.reason = "checksum differs within the sequence"
+			}
+			run.offsets = append(run.offsets, offset)
+			continue
+		}
+
+		if entry[11]&0x3f == 0x0f {
+			ord := entry[0] & 0x3f
+			switch {
+			case entry[0]&0x40 != 0:
+				// 新序列开始，之前的序列没有对应的短文件名项
+				malformed("not followed by a short name entry")
+				run = &lfnRun{start: i, ord: ord, sum: entry[13]}
+				if ord == 0 || ord > 20 {
+					run.reason = fmt.Sprintf("invalid sequence number %#x", entry[0])
+				}
+			case run == nil:
+				run = &lfnRun{start: i, reason: "sequence does not start with the last entry"}
+			case run.reason != "":
+			case ord != run.ord-1:
+				run.reason = fmt.Sprintf("sequence number %d follows %d", ord, run.ord)
+			case entry[13] != run.sum:
+				run.reason = "checksum differs within the sequence"
+			default:
+				run.ord = ord
+			}
+			run.offsets = append(run.offsets, offset)
+			continue
+		}
+
+		item := &DirItem{Offsets: []*DirEntryOffset{offset}, pos: i}
+		it.err = binary.Read(bytes.NewReader(entry), binary.LittleEndian, &item.Entry)
+		if it.err != nil {
+			it.done = true
+			return false
+		}
+		item.ShortName = it.vol.CodePage.shortName(item.Entry.FileName, item.Entry.CaseFlags)
+		if item.isDeleted() {
+			// 首字节被删除标记覆盖，由已删除长文件名项的校验和恢复，无法恢复时以 "?" 表示
+			name := item.Entry.FileName
+			name[0] = '?'
+			if run != nil && run.deleted && run.reason == "" {
+				name[0] = recoverFirstByte(run.sum, name)
+			}
+			item.ShortName = it.vol.CodePage.shortName(name, item.Entry.CaseFlags)
+		}
+		item.Name = item.ShortName
+		if run != nil {
+			switch {
+			case run.reason != "":
+			case run.deleted != item.isDeleted():
+				run.reason = "deleted and live entries mixed"
+			case run.deleted:
+			case run.ord != 1:
+				run.reason = fmt.Sprintf("sequence ends at %d, entries missing", run.ord)
+			case run.sum != shortNameChecksum(item.Entry.FileName):
+				run.reason = fmt.Sprintf("checksum %#x does not match short name %s", run.sum, item.ShortName)
+			}
+			if run.reason == "" {
+				item.LongName = decodeLongName(it.dir[run.start:i])
+				item.Name = displayName(item.LongName)
+				item.Offsets = append(run.offsets, offset)
+				item.pos = run.start
+				run = nil
+			} else {
+				malformed("")
+			}
+		}
+		it.item = item
+		it.pos = i + 32
+		return true
+	}
+	malformed("not followed by a short name entry")
+	it.done = true
+	return false
+}
+
+// scrubbed 判断目录项是否已被覆写，只剩删除标记
+func scrubbed(entry []byte) bool {
+	return entry[0] == 0xe5 && bytes.Count(entry[1:], []byte{0}) == len(entry)-1
+}
+
+// recoverFirstByte 由长文件名项中的校验和恢复短文件名被删除标记覆盖的首字节
+// 校验和与首字节一一对应，因此可以唯一确定首字节
+func recoverFirstByte(sum byte, name [11]byte) byte {
+	for c := 0; c < 256; c++ {
+		name[0] = byte(c)
+		if shortNameChecksum(name) == sum {
+			break
+		}
+	}
+	return name[0]
+}
+
+// Item 返回 Next 解析的目录项
+func (it *dirIterator) Item() *DirItem {
+	return it.item
+}
+
+// Err 返回迭代中遇到的错误
+func (it *dirIterator) Err() error {
+	return it.err
+}
+
+// decodeLongName 解码按磁盘顺序排列的长文件名项，序号最大的项在前
+// 文件名以0x0000结束，其后以0xFFFF填充；部分实现省略结束符直接填充，因此0xFFFF同样视为结束
+// 未配对的代理项解码为 U+FFFD
+func decodeLongName(lfn []byte) string {
+	var name []uint16
+	for i := len(lfn) - 32; i >= 0; i -= 32 {
+		entry := lfn[i : i+32]
+		for _, span := range [][2]int{{1, 11}, {14, 26}, {28, 32}} {
+			for j := span[0]; j < span[1]; j += 2 {
+				c := binary.LittleEndian.Uint16(entry[j:])
+				if c == 0 || c == 0xffff {
+					return string(utf16.Decode(name))
+				}
+				name = append(name, c)
+			}
+		}
+	}
+	return string(utf16.Decode(name))
+}
+
+// encodeLongName 编码长文件名目录项，按磁盘顺序返回（最后一个序号在前）
+func encodeLongName(name string, checksum byte) [][]byte {
+	units := utf16.Encode([]rune(name))
+	if len(units)%13 != 0 {
+		units = append(units, 0)
+	}
+	for len(units)%13 != 0 {
+		units = append(units, 0xffff)
+	}
+	count := len(units) / 13
+	entries := make([][]byte, 0, count)
+	for seq := count; seq >= 1; seq-- {
+		part := units[(seq-1)*13 : seq*13]
+		lDEntry := FAT32LongDirEntry{
+			SequenceNumber: byte(seq),
+			Attribute:      0x0f,
+			Checksum:       checksum,
+		}
+		if seq == count {
+			lDEntry.SequenceNumber |= 0x40
+		}
+		copy(lDEntry.Name1[:], part[0:5])
+		copy(lDEntry.Name2[:], part[5:11])
+		copy(lDEntry.Name3[:], part[11:13])
+		var buf bytes.Buffer
+		_ = binary.Write(&buf, binary.LittleEndian, &lDEntry)
+		entries = append(entries, buf.Bytes())
+	}
+	return entries
+}
+
+// shortNameChecksum 计算短文件名校验和，写入对应长文件名项
+func shortNameChecksum(name [11]byte) byte {
+	var sum byte
+	for _, c := range name {
+		sum = (sum&1)<<7 + sum>>1 + c
+	}
+	return sum
+}
+
+// dirChain 返回目录的簇链，去掉结束标记
+func dirChain(vol *Volume, dirCluster uint32) ([]uint32, error) {
+	return followChain(vol, dirCluster, 0)
+}
+
+// dirEntryOffset 返回目录内第 i 个字节所在的簇与簇内偏移
+func dirEntryOffset(vol *Volume, chain []uint32, i int) *DirEntryOffset {
+	clusterBytes := int(vol.BPRSector.BytesPerSector) * int(vol.BPRSector.SectorsPerCluster)
+	return &DirEntryOffset{ClusterNumber: chain[i/clusterBytes], Offset: uint32(i % clusterBytes)}
+}
+
+// readDir 读取目录的簇链与全部内容
+func readDir(vol *Volume, dirCluster uint32) ([]uint32, []byte, error) {
+	chain, err := dirChain(vol, dirCluster)
+	if err != nil {
+		return nil, nil, err
+	}
+	spc := uint16(vol.BPRSector.SectorsPerCluster)
+	clusterBytes := int(vol.BPRSector.BytesPerSector) * int(spc)
+	dir := make([]byte, 0, len(chain)*clusterBytes)
+	for _, cluster := range chain {
+		buf, err := vol.Driver.ReadSector(vol.clusterSector(cluster), spc)
+		if err != nil {
+			return nil, nil, err
+		}
+		dir = append(dir, buf...)
+	}
+	return chain, dir, nil
+}
+
+// writeDir 将目录内容中相对 old 发生变化的扇区写回设备
+func writeDir(vol *Volume, chain []uint32, old, cur []byte) error {
+	bytesPerSector := int(vol.BPRSector.BytesPerSector)
+	for i := 0; i+bytesPerSector <= len(cur); i += bytesPerSector {
+		if bytes.Equal(old[i:i+bytesPerSector], cur[i:i+bytesPerSector]) {
+			continue
+		}
+		err := vol.writeMeta(cur[i:i+bytesPerSector], vol.dEntrySector(dirEntryOffset(vol, chain, i)))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// listDir 列出目录中的文件与子目录，跳过卷标与 "."、".."，无效的长文件名项序列记录到日志
+func listDir(vol *Volume, dirCluster uint32) ([]*DirItem, error) {
+	it, err := newDirIterator(vol, dirCluster)
+	if err != nil {
+		return nil, err
+	}
+	var items []*DirItem
+	for it.Next() {
+		item := it.Item()
+		if item.isLabel() || item.isDot() {
+			continue
+		}
+		items = append(items, item)
+	}
+	if it.Err() != nil {
+		return nil, it.Err()
+	}
+	logMalformed(it)
+	return items, nil
+}
+
+// logMalformed 输出目录中无效的长文件名项序列
+func logMalformed(it *dirIterator) {
+	for _, run := range it.Malformed {
+		log.Println("Malformed", run)
+	}
+}
+
+// walkTree 先序遍历目录树，对每个文件与子目录调用 fn，dirPath 为以 / 分隔的目录路径
+func walkTree(vol *Volume, dirCluster uint32, dirPath string, fn func(path string, item *DirItem) error) error {
+	return walkTreeVisited(vol, dirCluster, dirPath, fn, make(map[uint32]bool))
+}
+
+func walkTreeVisited(vol *Volume, dirCluster uint32, dirPath string, fn func(path string, item *DirItem) error, visited map[uint32]bool) error {
+	// 损坏的卷中子目录可能指向祖先目录，避免无限递归
+	if visited[dirCluster] {
+		return fmt.Errorf("directory %s at cluster %d visited twice", dirPath, dirCluster)
+	}
+	visited[dirCluster] = true
+	items, err := listDir(vol, dirCluster)
+	if err != nil {
+		return err
+	}
+	for _, item := range items {
+		path := dirPath + "/" + item.Name
+		err = fn(path, item)
+		if err != nil {
+			return err
+		}
+		if item.Entry.FileAttributes&0x10 != 0 && item.cluster() != 0 {
+			err = walkTreeVisited(vol, item.cluster(), path, fn, visited)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// removeTarget 待删除的文件或目录及其目录项位置
+type removeTarget struct {
+	Path     string
+	DirEntry *FAT32DirEntry
+	Offsets  []*DirEntryOffset
+}
+
+// collectTargets 解析卷内路径，目录沿簇链后序遍历，子项先于所在目录，"." 与 ".." 不在其中
+// 子项的目录项位置由遍历直接得到，无需从根目录重新查找
+func collectTargets(vol *Volume, path, display string) ([]*removeTarget, error) {
+	dEntry, dEntryOffset, err := getDirEntry(vol, path)
+	if err != nil {
+		return nil, err
+	}
+	var targets []*removeTarget
+	var visit func(target *removeTarget) error
+	visited := make(map[uint32]bool)
+	visit = func(target *removeTarget) error {
+		cluster := uint32(target.DirEntry.ClusterHigh)<<16 | uint32(target.DirEntry.ClusterLow)
+		if target.DirEntry.FileAttributes&0x10 != 0 && cluster != 0 {
+			if visited[cluster] {
+				return fmt.Errorf("directory %s at cluster %d visited twice", target.Path, cluster)
+			}
+			visited[cluster] = true
+			items, err := listDir(vol, cluster)
+			if err != nil {
+				return err
+			}
+			for _, item := range items {
+				err = visit(&removeTarget{
+					Path:     filepath.Join(target.Path, item.Name),
+					DirEntry: &item.Entry,
+					Offsets:  item.Offsets,
+				})
+				if err != nil {
+					return err
+				}
+			}
+		}
+		targets = append(targets, target)
+		return nil
+	}
+	err = visit(&removeTarget{Path: display, DirEntry: dEntry, Offsets: dEntryOffset})
+	if err != nil {
+		return nil, err
+	}
+	return targets, nil
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// patchEntry 修改目录项中第 index 个字节
+func patchEntry(t *testing.T, vol *Volume, offset *DirEntryOffset, index int, value byte) {
+	t.Helper()
+	bytesPerSector := uint32(vol.BPRSector.BytesPerSector)
+	err := vol.Driver.WriteData([]byte{value}, vol.dEntrySector(offset), uint16(offset.Offset%bytesPerSector)+uint16(index))
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDirIterator(t *testing.T) {
+	b := NewVolumeBuilder(512, 1)
+	label := b.AddFile("BACKUP", nil)
+	label.Attr = 0x08
+	readOnly := b.AddFile("Read Only Archive.txt", fill(10, 1))
+	readOnly.Attr = 0x21
+	hidden := b.AddFile("Hidden System File.sys", fill(10, 2))
+	hidden.Attr = 0x06
+	checksum := b.AddFile("Wrong Checksum Name.txt", fill(10, 3))
+	order := b.AddFile("Out Of Order Sequence Number.txt", fill(10, 4))
+	deleted := b.AddFile("Deleted Short Entry.txt", fill(10, 5))
+	end := b.AddFile("After The End.txt", fill(10, 6))
+	b.AddFile("HIDDEN.TXT", fill(10, 7))
+	_, vol := buildVolume(t, b)
+
+	patchEntry(t, vol, checksum.Offsets[1], 13, 0x42)
+	patchEntry(t, vol, order.Offsets[0], 0, 0x40|2)
+	patchEntry(t, vol, order.Offsets[1], 0, 3)
+	patchEntry(t, vol, deleted.Offsets[len(deleted.Offsets)-1], 0, 0xe5)
+	patchEntry(t, vol, end.Offsets[0], 0, 0)
+
+	it, err := newDirIterator(vol, vol.BPRSector.RootCluster)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var items []*DirItem
+	for it.Next() {
+		items = append(items, it.Item())
+	}
+	if it.Err() != nil {
+		t.Fatal(it.Err())
+	}
+
+	// 卷标与任意属性组合的文件均返回，长文件名无效时只有短文件名
+	want := []struct {
+		entry *BuildEntry
+		name  string
+	}{
+		{label, "BACKUP"},
+		{readOnly, "Read Only Archive.txt"},
+		{hidden, "Hidden System File.sys"},
+		{checksum, "WRONGC~1.TXT"},
+		{order, "OUTOFO~1.TXT"},
+	}
+	if len(items) != len(want) {
+		t.Fatalf("got %d items, want %d", len(items), len(want))
+	}
+	for i, w := range want {
+		item := items[i]
+		if item.Name != w.name || item.Entry.FileAttributes != w.entry.Attr {
+			t.Errorf("item %d: %s attr %#x, want %s attr %#x", i, item.Name, item.Entry.FileAttributes, w.name, w.entry.Attr)
+		}
+		sfn := w.entry.Offsets[len(w.entry.Offsets)-1]
+		if last := item.Offsets[len(item.Offsets)-1]; *last != *sfn {
+			t.Errorf("%s: short entry at %d, want %d", item.Name, last.Offset, sfn.Offset)
+		}
+		if !item.Modified().Equal(b.Time) || !item.Created().Equal(b.Time) {
+			t.Errorf("%s: modified %s created %s", item.Name, item.Modified(), item.Created())
+		}
+		if item.Entry.FileSize != uint32(len(w.entry.Content)) {
+			t.Errorf("%s: size %d", item.Name, item.Entry.FileSize)
+		}
+	}
+	if len(items[1].Offsets) != len(readOnly.Offsets) {
+		t.Error("long name entries of read-only file not returned")
+	}
+
+	reasons := []string{"checksum", "sequence number", "deleted entry"}
+	if len(it.Malformed) != len(reasons) {
+		t.Fatalf("got %d malformed runs, want %d: %v", len(it.Malformed), len(reasons), it.Malformed)
+	}
+	for i, reason := range reasons {
+		if !strings.Contains(it.Malformed[i].Reason, reason) {
+			t.Errorf("malformed run %d: %s, want %s", i, it.Malformed[i].Reason, reason)
+		}
+	}
+
+	// 目录结束标志之后的目录项不可见，卷标不能作为文件删除
+	for _, path := range []string{"BACKUP", "HIDDEN.TXT", "Wrong Checksum Name.txt"} {
+		if _, _, err := getDirEntry(vol, path); err == nil {
+			t.Errorf("%s: found", path)
+		}
+	}
+	lookup(t, vol, "hidden system file.sys")
+	lookup(t, vol, "WRONGC~1.TXT")
+}
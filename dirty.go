@@ -0,0 +1,101 @@
+package main
+
+import "log"
+
+// FAT[1] 高位的卷状态标志，置位表示正常
+const (
+	fatCleanShutdown = 0x08000000 // 清零表示卷未正常卸载
+	fatNoHardError   = 0x04000000 // 清零表示卷出现过读写错误
+)
+
+// DirtyVolumeError 卷已被标记为脏或出现过读写错误，需要先检查文件系统
+type DirtyVolumeError struct {
+	Reason string
+}
+
+func (e *DirtyVolumeError) Error() string {
+	return "volume " + e.Reason + ", run a file system check first or use --force"
+}
+
+// volumeFlags 读取活动FAT表中 FAT[1] 的卷状态
+func volumeFlags(vol *Volume) (uint32, error) {
+	return vol.fat.get(vol, 1)
+}
+
+// setVolumeFlags 修改所有FAT表副本中 FAT[1] 的卷状态位并同步到设备
+func setVolumeFlags(vol *Volume, set bool, mask uint32) error {
+	entry, err := vol.fat.get(vol, 1)
+	if err != nil {
+		return err
+	}
+	if set {
+		entry |= mask
+	} else {
+		entry &^= mask
+	}
+	err = vol.fat.set(vol, 1, entry)
+	if err != nil {
+		return err
+	}
+	err = vol.fat.flush(vol)
+	if err != nil {
+		return err
+	}
+	return syncDriver(vol.Driver)
+}
+
+// checkClean 检查卷是否已被标记为脏，force 为真时仅给出警告，并在操作完成后保留脏标记
+func checkClean(vol *Volume, force bool) error {
+	flags, err := volumeFlags(vol)
+	if err != nil {
+		return err
+	}
+	reason := ""
+	if flags&fatCleanShutdown == 0 {
+		reason = "is marked dirty (not cleanly unmounted or a previous run was interrupted)"
+	} else if flags&fatNoHardError == 0 {
+		reason = "has recorded hard I/O errors"
+	}
+	if reason == "" {
+		return nil
+	}
+	if !force {
+		return &DirtyVolumeError{Reason: reason}
+	}
+	log.Printf("Warning: volume %s, continuing because of --force", reason)
+	vol.KeepDirty = true
+	return nil
+}
+
+// markDirty 在第一次写入元数据前将卷标记为脏，写入中断时系统会在下次挂载时检查卷
+func markDirty(vol *Volume) error {
+	if vol.dirty {
+		return nil
+	}
+	vol.dirty = true
+	flags, err := volumeFlags(vol)
+	if err != nil || flags&fatCleanShutdown == 0 {
+		return err
+	}
+	return setVolumeFlags(vol, false, fatCleanShutdown)
+}
+
+// markClean 所有FAT表、FSInfo与目录项同步到设备后清除脏标记，卷原本为脏时保留
+func markClean(vol *Volume) error {
+	if !vol.dirty || vol.KeepDirty {
+		return nil
+	}
+	err := syncDriver(vol.Driver)
+	if err != nil {
+		return err
+	}
+	err = setVolumeFlags(vol, true, fatCleanShutdown)
+	if err != nil {
+		return err
+	}
+	vol.dirty = false
+	if vol.Verifier != nil {
+		return vol.Verifier.Check(vol.Driver)
+	}
+	return nil
+}
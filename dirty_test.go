@@ -0,0 +1,111 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"testing"
+)
+
+// flagDriver 记录每次写入时各FAT表副本中 FAT[1] 是否为脏
+type flagDriver struct {
+	*MemDriver
+	vol    *Volume
+	writes []bool
+}
+
+func (d *flagDriver) WriteData(data []byte, sectorNum uint64, offset uint16) error {
+	dirty := true
+	for _, fat := range d.vol.fatCopies() {
+		buf, _ := d.MemDriver.ReadSector(d.vol.fatCopySector(fat, 0), 1)
+		dirty = dirty && buf[7]&0x08 == 0
+	}
+	d.writes = append(d.writes, dirty)
+	return d.MemDriver.WriteData(data, sectorNum, offset)
+}
+
+func TestDirtyBitAroundRemoval(t *testing.T) {
+	b := NewVolumeBuilder(512, 1)
+	b.AddFileAt("a.txt", fill(1500, 1), 10, 11, 300)
+	mem, err := b.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	driver := &flagDriver{MemDriver: mem}
+	vol, err := NewVolume(driver)
+	if err != nil {
+		t.Fatal(err)
+	}
+	driver.vol = vol
+
+	dEntry, dEntryOffset := lookup(t, vol, "a.txt")
+	err = markDirty(vol)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dirtyWrites := len(driver.writes)
+	wiper, _ := NewWiper(WipeProfiles["zero"], nil)
+	err = doRemoveFile(vol, &RemoveOptions{Wiper: wiper}, "a.txt", dEntry, dEntryOffset)
+	if err != nil {
+		t.Fatal(err)
+	}
+	removeWrites := len(driver.writes)
+	err = markClean(vol)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 标记为脏的写入之后、清除之前的每次写入都必须发生在卷为脏时
+	for i := dirtyWrites; i < removeWrites; i++ {
+		if !driver.writes[i] {
+			t.Errorf("write %d happened while volume was clean", i)
+		}
+	}
+	for _, fat := range vol.fatCopies() {
+		buf, _ := mem.ReadSector(vol.fatCopySector(fat, 0), 1)
+		if !bytes.Equal(buf[4:8], []byte{0xff, 0xff, 0xff, 0x0f}) {
+			t.Errorf("FAT%d[1] = %x after removal", fat+1, buf[4:8])
+		}
+	}
+}
+
+func TestRemoveRefusesDirtyVolume(t *testing.T) {
+	b := NewVolumeBuilder(512, 1)
+	b.AddFile("a.txt", fill(700, 1))
+	b.AddFile("b.txt", fill(700, 2))
+	driver, vol := buildVolume(t, b)
+	err := setVolumeFlags(vol, false, fatCleanShutdown)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := saveImage(t, driver)
+	before, _ := os.ReadFile(path)
+
+	wiper, _ := NewWiper(WipeProfiles["zero"], nil)
+	err = RemoveImageFile(path, "a.txt", &RemoveOptions{Wiper: wiper})
+	var dirty *DirtyVolumeError
+	if !errors.As(err, &dirty) {
+		t.Fatalf("got %v, want DirtyVolumeError", err)
+	}
+	if after, _ := os.ReadFile(path); !bytes.Equal(before, after) {
+		t.Error("dirty volume was modified")
+	}
+	// dry-run 同样报告实际执行时会拒绝
+	err = RemoveImageFile(path, "a.txt", &RemoveOptions{Wiper: wiper, DryRun: true})
+	if !errors.As(err, &dirty) {
+		t.Fatalf("dry-run: got %v, want DirtyVolumeError", err)
+	}
+
+	// 强制执行时完成删除，但保留脏标记
+	err = RemoveImageFile(path, "b.txt", &RemoveOptions{Wiper: wiper, Force: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	vol = openImage(t, path)
+	if _, _, err := getDirEntry(vol, "b.txt"); err == nil {
+		t.Error("b.txt still present after forced removal")
+	}
+	if flags, _ := volumeFlags(vol); flags&fatCleanShutdown != 0 {
+		t.Error("forced removal cleared the dirty bit of a dirty volume")
+	}
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"container/list"
+	"encoding/binary"
+	"errors"
+	"sort"
+)
+
+const (
+	fatWindowSectors = 32 // 每个缓存窗口的扇区数
+	fatCacheWindows  = 64 // 缓存的窗口数上限，512字节扇区时约占用1MB内存
+)
+
+// fatWindow FAT表中连续 fatWindowSectors 个扇区的表项
+type fatWindow struct {
+	base  uint32          // 窗口起始扇区在FAT表中的序号
+	links []uint32        // 窗口内的表项
+	dirty map[uint32]bool // 已修改未写回的扇区序号
+}
+
+// fatCache 每个卷独立的FAT表缓存，按窗口缓存活动FAT表，以LRU淘汰
+// 修改的扇区标记为脏，flush 或淘汰时写回所有需要同步的FAT表副本
+type fatCache struct {
+	capacity int
+	windows  map[uint32]*list.Element
+	lru      *list.List // 最近使用的窗口在前
+}
+
+func newFATCache(capacity int) *fatCache {
+	return &fatCache{
+		capacity: capacity,
+		windows:  make(map[uint32]*list.Element),
+		lru:      list.New(),
+	}
+}
+
+// window 返回包含第n个FAT扇区的窗口，未缓存时读入，超出容量时写回并淘汰最久未使用的窗口
+func (c *fatCache) window(vol *Volume, n uint32) (*fatWindow, error) {
+	base := n - n%fatWindowSectors
+	if elem, ok := c.windows[base]; ok {
+		c.lru.MoveToFront(elem)
+		return elem.Value.(*fatWindow), nil
+	}
+	count := min(uint32(fatWindowSectors), vol.BPRSector.SectorsPerFAT32-base)
+	buffer, err := vol.Driver.ReadSector(vol.fatSector(base), uint16(count))
+	if err != nil {
+		return nil, err
+	}
+	w := &fatWindow{base: base, links: make([]uint32, len(buffer)/4), dirty: make(map[uint32]bool)}
+	for i := range w.links {
+		w.links[i] = binary.LittleEndian.Uint32(buffer[i*4:])
+	}
+	for c.lru.Len() >= c.capacity {
+		oldest := c.lru.Back()
+		err = c.writeBack(vol, oldest.Value.(*fatWindow))
+		if err != nil {
+			return nil, err
+		}
+		delete(c.windows, oldest.Value.(*fatWindow).base)
+		c.lru.Remove(oldest)
+	}
+	c.windows[base] = c.lru.PushFront(w)
+	return w, nil
+}
+
+// entry 返回表项所在的窗口与表项在窗口中的下标
+func (c *fatCache) entry(vol *Volume, cluster uint32) (*fatWindow, uint32, error) {
+	entriesPerSector := uint32(vol.BPRSector.BytesPerSector) / 4
+	w, err := c.window(vol, cluster/entriesPerSector)
+	if err != nil {
+		return nil, 0, err
+	}
+	i := cluster - w.base*entriesPerSector
+	if i >= uint32(len(w.links)) {
+		return nil, 0, errors.New("fat entry out of range")
+	}
+	return w, i, nil
+}
+
+// get 读取表项的原始值，包括高4位
+func (c *fatCache) get(vol *Volume, cluster uint32) (uint32, error) {
+	w, i, err := c.entry(vol, cluster)
+	if err != nil {
+		return 0, err
+	}
+	return w.links[i], nil
+}
+
+// set 修改缓存中的表项并将所在扇区标记为脏，value 原样写入，调用者负责保留高4位
+func (c *fatCache) set(vol *Volume, cluster, value uint32) error {
+	w, i, err := c.entry(vol, cluster)
+	if err != nil {
+		return err
+	}
+	if w.links[i] != value {
+		w.links[i] = value
+		w.dirty[w.base+i/(uint32(vol.BPRSector.BytesPerSector)/4)] = true
+	}
+	return nil
+}
+
+// writeBack 按扇区顺序将窗口中的脏扇区写入所有FAT表副本
+func (c *fatCache) writeBack(vol *Volume, w *fatWindow) error {
+	sectors := make([]uint32, 0, len(w.dirty))
+	for n := range w.dirty {
+		sectors = append(sectors, n)
+	}
+	sort.Slice(sectors, func(i, j int) bool {
+		return sectors[i] < sectors[j]
+	})
+	entriesPerSector := vol.BPRSector.BytesPerSector / 4
+	buf := make([]byte, vol.BPRSector.BytesPerSector)
+	for _, n := range sectors {
+		links := w.links[(n-w.base)*uint32(entriesPerSector):][:entriesPerSector]
+		for i, link := range links {
+			binary.LittleEndian.PutUint32(buf[i*4:], link)
+		}
+		err := vol.writeFATSector(n, buf)
+		if err != nil {
+			return err
+		}
+		delete(w.dirty, n)
+	}
+	return nil
+}
+
+// flush 将所有脏扇区写回FAT表副本，按扇区顺序写入
+func (c *fatCache) flush(vol *Volume) error {
+	windows := make([]*fatWindow, 0, c.lru.Len())
+	for elem := c.lru.Front(); elem != nil; elem = elem.Next() {
+		if w := elem.Value.(*fatWindow); len(w.dirty) > 0 {
+			windows = append(windows, w)
+		}
+	}
+	sort.Slice(windows, func(i, j int) bool {
+		return windows[i].base < windows[j].base
+	})
+	for _, w := range windows {
+		err := c.writeBack(vol, w)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// invalidate 丢弃所有缓存的窗口，绕过缓存直接写入FAT表后调用，未写回的修改一并丢弃
+func (c *fatCache) invalidate() {
+	c.windows = make(map[uint32]*list.Element)
+	c.lru.Init()
+}
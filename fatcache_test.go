@@ -0,0 +1,136 @@
+package main
+
+import (
+	"encoding/binary"
+	"testing"
+)
+
+// fatReadDriver 统计从FAT表区读取的扇区数
+type fatReadDriver struct {
+	*MemDriver
+	fatStart, fatEnd uint64
+	reads            int
+}
+
+func (d *fatReadDriver) ReadSector(sectorNum uint64, readNum uint16) ([]byte, error) {
+	if sectorNum >= d.fatStart && sectorNum < d.fatEnd {
+		d.reads += int(readNum)
+	}
+	return d.MemDriver.ReadSector(sectorNum, readNum)
+}
+
+// fatEntryAt 直接从设备读取第i个FAT表副本中的表项
+func fatEntryAt(t *testing.T, vol *Volume, mem *MemDriver, fat, cluster uint32) uint32 {
+	t.Helper()
+	entriesPerSector := uint32(vol.BPRSector.BytesPerSector) / 4
+	buf, err := mem.ReadSector(vol.fatCopySector(fat, cluster/entriesPerSector), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return binary.LittleEndian.Uint32(buf[cluster%entriesPerSector*4:])
+}
+
+func TestFATCacheFragmentedChain(t *testing.T) {
+	// 簇链在三个相距很远的窗口之间来回跳转
+	var clusters []uint32
+	for i := uint32(0); i < 30; i++ {
+		clusters = append(clusters, 10+i, 20000+i, 40000+i)
+	}
+	b := NewVolumeBuilder(512, 1)
+	b.AddFileAt("fragmented.bin", fill(len(clusters)*512, 1), clusters...)
+	mem, err := b.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	driver := &fatReadDriver{MemDriver: mem}
+	vol, err := NewVolume(driver)
+	if err != nil {
+		t.Fatal(err)
+	}
+	driver.fatStart = uint64(vol.Offset.DEntry)
+	driver.fatEnd = uint64(vol.Offset.Data)
+
+	dEntry, offsets := lookup(t, vol, "fragmented.bin")
+	driver.reads = 0
+	wiper, _ := NewWiper(WipeProfiles["zero"], nil)
+	err = doRemoveFile(vol, &RemoveOptions{Wiper: wiper}, "fragmented.bin", dEntry, offsets)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 每个窗口只读取一次
+	if driver.reads > 3*fatWindowSectors {
+		t.Errorf("read %d FAT sectors, want at most %d", driver.reads, 3*fatWindowSectors)
+	}
+	for _, fat := range vol.fatCopies() {
+		for _, cluster := range clusters {
+			if entry := fatEntryAt(t, vol, mem, fat, cluster); entry != 0 {
+				t.Errorf("FAT%d[%d] = %#x, want 0", fat+1, cluster, entry)
+			}
+		}
+	}
+}
+
+func TestFATCacheEviction(t *testing.T) {
+	b := NewVolumeBuilder(512, 1)
+	b.AddFileAt("a.bin", fill(100, 1), 10)
+	b.AddFileAt("b.bin", fill(100, 2), 5000)
+	b.AddFileAt("c.bin", fill(100, 3), 9000)
+	mem, vol := buildVolume(t, b)
+	vol.fat = newFATCache(2)
+
+	// 修改第一个窗口后读入两个新窗口，第一个窗口被淘汰时写回所有副本
+	for _, cluster := range []uint32{10, 5000} {
+		err := vol.fat.set(vol, cluster, 0xf0000000)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, fat := range vol.fatCopies() {
+		if entry := fatEntryAt(t, vol, mem, fat, 10); entry&fatEntryMask < fatEndOfChain {
+			t.Errorf("FAT%d[10] written before eviction: %#x", fat+1, entry)
+		}
+	}
+	if _, err := readFATEntry(vol, 9000); err != nil {
+		t.Fatal(err)
+	}
+	for _, fat := range vol.fatCopies() {
+		if entry := fatEntryAt(t, vol, mem, fat, 10); entry != 0xf0000000 {
+			t.Errorf("FAT%d[10] = %#x after eviction", fat+1, entry)
+		}
+		if entry := fatEntryAt(t, vol, mem, fat, 5000); entry&fatEntryMask < fatEndOfChain {
+			t.Errorf("FAT%d[5000] written before flush: %#x", fat+1, entry)
+		}
+	}
+
+	err := vol.fat.flush(vol)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, fat := range vol.fatCopies() {
+		if entry := fatEntryAt(t, vol, mem, fat, 5000); entry != 0xf0000000 {
+			t.Errorf("FAT%d[5000] = %#x after flush", fat+1, entry)
+		}
+	}
+	if entry, _ := readFATEntry(vol, 10); entry != 0xf0000000 {
+		t.Errorf("evicted entry read back as %#x", entry)
+	}
+}
+
+func TestFATCachePerVolume(t *testing.T) {
+	b1 := NewVolumeBuilder(512, 1)
+	b1.AddFileAt("a.bin", fill(1024, 1), 10, 11)
+	b2 := NewVolumeBuilder(512, 1)
+	b2.AddFileAt("a.bin", fill(1024, 2), 10, 12)
+	_, vol1 := buildVolume(t, b1)
+	_, vol2 := buildVolume(t, b2)
+
+	// 两个卷同时打开时各自的缓存互不影响
+	for i := 0; i < 2; i++ {
+		if entry, _ := readFATEntry(vol1, 10); entry != 11 {
+			t.Errorf("volume 1: FAT[10] = %#x, want 11", entry)
+		}
+		if entry, _ := readFATEntry(vol2, 10); entry != 12 {
+			t.Errorf("volume 2: FAT[10] = %#x, want 12", entry)
+		}
+	}
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// wipeFreeBatch 每次覆写的空闲簇数，每批完成后保存进度
+const wipeFreeBatch = 256
+
+// WipeFreeState 空闲空间覆写的进度，中断后从 Next 继续
+type WipeFreeState struct {
+	Serial   uint32      // 卷序列号，继续时确认为同一个卷
+	Wipe     WipeProfile // 覆写标准，继续时每一遍覆写必须一致，自定义模式的名称相同也不能代替比较
+	Next     uint32      // 下一个待扫描的簇，之前的空闲簇均已覆写
+	Clusters uint64      // 已覆写的簇数
+}
+
+// WipeFreeResult 空闲空间覆写的统计
+type WipeFreeResult struct {
+	Scanned  uint32 // 本次扫描的簇数
+	Clusters uint64 // 累计覆写的空闲簇数，包括中断前的部分
+	Bytes    uint64 // 累计覆写的字节数
+}
+
+// defaultWipeFreeState 默认进度文件路径，与预写日志位于同一目录，按卷序列号区分
+func defaultWipeFreeState(serial uint32) string {
+	return filepath.Join(filepath.Dir(DefaultJournalPath()), fmt.Sprintf("wipe-free-%08x.json", serial))
+}
+
+// loadWipeFreeState 读取进度文件，不存在时返回nil
+func loadWipeFreeState(path string) (*WipeFreeState, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var state WipeFreeState
+	err = json.Unmarshal(data, &state)
+	if err != nil {
+		return nil, fmt.Errorf("wipe-free state %s: %w", path, err)
+	}
+	return &state, nil
+}
+
+// saveWipeFreeState 先写入临时文件再重命名，保证进度文件始终完整
+func saveWipeFreeState(path string, state *WipeFreeState) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(filepath.Dir(path), 0o700)
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	err = os.WriteFile(tmp, data, 0o600)
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// wipeFree 扫描FAT表，按批覆写所有空闲簇，每批完成后保存进度并输出百分比
+func wipeFree(vol *Volume, opts *RemoveOptions, state *WipeFreeState, statePath string, progress io.Writer) (*WipeFreeResult, error) {
+	end := vol.ClusterCount() + 2
+	clusterBytes := uint64(vol.BPRSector.BytesPerSector) * uint64(vol.BPRSector.SectorsPerCluster)
+	result := &WipeFreeResult{}
+	lastPercent := -1
+	var batch []uint32
+
+	flush := func(next uint32) error {
+		err := cleanFileContent(vol, opts, batch)
+		if err != nil {
+			return err
+		}
+		state.Clusters += uint64(len(batch))
+		state.Next = next
+		batch = batch[:0]
+		err = saveWipeFreeState(statePath, state)
+		if err != nil {
+			return err
+		}
+		if percent := int(uint64(next-2) * 100 / uint64(end-2)); percent != lastPercent {
+			lastPercent = percent
+			fmt.Fprintf(progress, "\rwipe-free: %3d%%  %d/%d clusters, %d wiped", percent, next-2, end-2, state.Clusters)
+		}
+		return nil
+	}
+
+	start := max(state.Next, 2)
+	for cluster := start; cluster < end; cluster++ {
+		entry, err := readFATEntry(vol, cluster)
+		if err != nil {
+			return nil, err
+		}
+		result.Scanned++
+		if entry&0x0fffffff != 0 {
+			continue
+		}
+		batch = append(batch, cluster)
+		if len(batch) == wipeFreeBatch {
+			err = flush(cluster + 1)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	err := flush(end)
+	if err != nil {
+		return nil, err
+	}
+	fmt.Fprintln(progress)
+	result.Clusters = state.Clusters
+	result.Bytes = state.Clusters * clusterBytes
+	return result, nil
+}
+
+// WipeFree 覆写卷上所有空闲簇，image 为空时 target 为挂载卷上的任意路径
+// 进度保存在 statePath，为空时使用默认路径；restart 为真时忽略已有进度
+func WipeFree(image, target string, opts *RemoveOptions, statePath string, restart bool) error {
+	driver, vol, _, err := openPlanTarget(image, target, false)
+	if err != nil {
+		return err
+	}
+	defer driver.DDestroy()
+
+	// 卷为脏时FAT表可能未记录正在使用的簇，覆写会破坏文件
+	err = checkClean(vol, opts.Force)
+	if err != nil {
+		return err
+	}
+	serial := vol.BPRSector.VolumeSerialNumber
+	if statePath == "" {
+		statePath = defaultWipeFreeState(serial)
+	}
+	state := &WipeFreeState{Serial: serial, Wipe: opts.Wiper.Profile}
+	if !restart {
+		saved, err := loadWipeFreeState(statePath)
+		if err != nil {
+			return err
+		}
+		if saved != nil {
+			if saved.Serial != serial || !saved.Wipe.samePasses(state.Wipe) {
+				return fmt.Errorf("wipe-free state %s belongs to volume %08x with %s, use --restart", statePath, saved.Serial, saved.Wipe)
+			}
+			log.Printf("Resuming wipe-free at cluster %d, %d clusters already wiped", saved.Next, saved.Clusters)
+			state = saved
+		}
+	}
+
+	log.Println("Wipe standard:", opts.Wiper.Profile)
+	begin := time.Now()
+	result, err := wipeFree(vol, opts, state, statePath, os.Stderr)
+	if err != nil {
+		return err
+	}
+	err = os.Remove(statePath)
+	if err != nil {
+		return err
+	}
+	log.Printf("Wiped %d free clusters, %d bytes, scanned %d clusters in %s",
+		result.Clusters, result.Bytes, result.Scanned, time.Since(begin).Round(time.Second))
+	log.Println("Wiped", opts.Wiper.Stats)
+	return nil
+}
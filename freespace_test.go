@@ -0,0 +1,117 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// countDriver 统计写入的扇区数，剩余扇区数不足时写入失败，left 为负时不限制
+type countDriver struct {
+	*MemDriver
+	left   int
+	writes int
+}
+
+func (d *countDriver) WriteData(data []byte, sectorNum uint64, offset uint16) error {
+	sectors := max(len(data)/int(d.BytesPerSector), 1)
+	if d.left >= 0 && d.left < sectors {
+		return errCrash
+	}
+	if d.left >= 0 {
+		d.left -= sectors
+	}
+	d.writes += sectors
+	return d.MemDriver.WriteData(data, sectorNum, offset)
+}
+
+func TestWipeFreeResume(t *testing.T) {
+	b := NewVolumeBuilder(512, 1)
+	b.ClusterCount = 65525
+	keep := b.AddFileAt("keep.bin", fill(1024, 7), 5000, 5001)
+	mem, vol := buildVolume(t, b)
+	var used uint32
+	for cluster := uint32(2); cluster < vol.ClusterCount()+2; cluster++ {
+		if entry, _ := readFATEntry(vol, cluster); entry != 0 {
+			used++
+		}
+	}
+	free := uint64(vol.ClusterCount() - used)
+	// 空闲簇中残留的旧数据
+	junk := []uint32{4999, 5002, 40000, vol.ClusterCount() + 1}
+	for _, cluster := range junk {
+		_ = mem.WriteData(fill(512, 9), vol.clusterSector(cluster), 0)
+	}
+
+	statePath := filepath.Join(t.TempDir(), "state.json")
+	wiper, _ := NewWiper(WipeProfiles["zero"], nil)
+	opts := &RemoveOptions{Wiper: wiper}
+	state := &WipeFreeState{Serial: vol.BPRSector.VolumeSerialNumber, Wipe: wiper.Profile}
+
+	// 中途写入失败，已完成的批次记录在进度文件中
+	driver := &countDriver{MemDriver: mem, left: 20000}
+	vol, _ = NewVolume(driver)
+	_, err := wipeFree(vol, opts, state, statePath, io.Discard)
+	if !errors.Is(err, errCrash) {
+		t.Fatalf("got %v, want simulated crash", err)
+	}
+	saved, err := loadWipeFreeState(statePath)
+	if err != nil || saved == nil || saved.Next <= 2 {
+		t.Fatalf("progress not saved: %+v %v", saved, err)
+	}
+
+	// 从进度继续，只覆写剩余的空闲簇
+	done := saved.Clusters
+	driver = &countDriver{MemDriver: mem, left: -1}
+	vol, _ = NewVolume(driver)
+	result, err := wipeFree(vol, opts, saved, statePath, io.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Clusters != free || result.Bytes != free*512 {
+		t.Errorf("wiped %d clusters %d bytes, want %d clusters", result.Clusters, result.Bytes, free)
+	}
+	if want := free - done; uint64(driver.writes) != want {
+		t.Errorf("resumed run wrote %d sectors, want %d", driver.writes, want)
+	}
+	for _, cluster := range junk {
+		if !bytes.Equal(readCluster(t, vol, cluster), make([]byte, 512)) {
+			t.Errorf("free cluster %d not wiped", cluster)
+		}
+	}
+	for i, cluster := range keep.Clusters {
+		if !bytes.Equal(readCluster(t, vol, cluster), keep.Content[i*512:(i+1)*512]) {
+			t.Errorf("allocated cluster %d modified", cluster)
+		}
+	}
+}
+
+func TestWipeFreeRefusesOtherPattern(t *testing.T) {
+	b := NewVolumeBuilder(512, 1)
+	b.AddFile("keep.bin", fill(1024, 7))
+	mem, vol := buildVolume(t, b)
+	image := saveImage(t, mem)
+	statePath := filepath.Join(t.TempDir(), "state.json")
+
+	// 两个自定义模式名称与遍数相同，覆写内容不同
+	zeros, _ := ParseWipePattern("0x00")
+	ones, _ := ParseWipePattern("0xff")
+	err := saveWipeFreeState(statePath, &WipeFreeState{Serial: vol.BPRSector.VolumeSerialNumber, Wipe: zeros, Next: 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+	before, _ := os.ReadFile(image)
+
+	wiper, _ := NewWiper(ones, nil)
+	err = WipeFree(image, "", &RemoveOptions{Wiper: wiper}, statePath, false)
+	if err == nil || !strings.Contains(err.Error(), "--restart") {
+		t.Fatalf("error = %v, want refusal to resume with another pattern", err)
+	}
+	if after, _ := os.ReadFile(image); !bytes.Equal(before, after) {
+		t.Error("image modified although resume was refused")
+	}
+}
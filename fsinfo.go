@@ -0,0 +1,53 @@
+package main
+
+import "encoding/binary"
+
+// FSInfo 扇区的签名与字段偏移
+const (
+	fsInfoLeadSig   = 0x41615252
+	fsInfoStructSig = 0x61417272
+	fsInfoTrailSig  = 0xaa550000
+	fsInfoFreeCount = 488 // 空闲簇数，0xFFFFFFFF 表示未知
+	fsInfoNextFree  = 492 // 下一个空闲簇的提示，0xFFFFFFFF 表示未知
+	fsInfoUnknown   = 0xffffffff
+)
+
+// readFSInfo 读取FSInfo扇区，卷没有FSInfo或签名不正确时返回nil
+func readFSInfo(vol *Volume) ([]byte, error) {
+	sectorNum := vol.BPRSector.FSInfoSector
+	if sectorNum == 0 || sectorNum == 0xffff {
+		return nil, nil
+	}
+	buf, err := vol.Driver.ReadSector(uint64(sectorNum), 1)
+	if err != nil {
+		return nil, err
+	}
+	if len(buf) < 512 ||
+		binary.LittleEndian.Uint32(buf[0:]) != fsInfoLeadSig ||
+		binary.LittleEndian.Uint32(buf[484:]) != fsInfoStructSig ||
+		binary.LittleEndian.Uint32(buf[508:]) != fsInfoTrailSig {
+		return nil, nil
+	}
+	return buf, nil
+}
+
+// updateFSInfo 释放簇后更新FSInfo的空闲簇数，并将空闲簇提示前移至 lowest
+func updateFSInfo(vol *Volume, freed uint32, lowest uint32) error {
+	if freed == 0 {
+		return nil
+	}
+	buf, err := readFSInfo(vol)
+	if err != nil || buf == nil {
+		return err
+	}
+	freeCount := binary.LittleEndian.Uint32(buf[fsInfoFreeCount:])
+	if freeCount != fsInfoUnknown {
+		freeCount = min(freeCount+freed, vol.ClusterCount())
+		binary.LittleEndian.PutUint32(buf[fsInfoFreeCount:], freeCount)
+	}
+	nextFree := binary.LittleEndian.Uint32(buf[fsInfoNextFree:])
+	if nextFree == fsInfoUnknown || lowest < nextFree {
+		binary.LittleEndian.PutUint32(buf[fsInfoNextFree:], lowest)
+	}
+	return vol.writeMeta(buf, uint64(vol.BPRSector.FSInfoSector))
+}
@@ -5,6 +5,7 @@ go 1.22.7
 require (
 	github.com/urfave/cli/v2 v2.27.5
 	golang.org/x/sys v0.27.0
+	golang.org/x/text v0.21.0
 )
 
 require (
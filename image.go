@@ -0,0 +1,67 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"os"
+)
+
+// ImageDriver 直接读写FAT32磁盘镜像文件的驱动器，无需挂载与root权限
+// 镜像内文件路径均相对于卷根目录
+type ImageDriver struct {
+	File      *os.File
+	BPRSector *FAT32BootSector
+	ReadOnly  bool // 只读打开镜像，用于 dry-run
+}
+
+func (d *ImageDriver) DInit(imagePath string) error {
+	mode := os.O_RDWR
+	if d.ReadOnly {
+		mode = os.O_RDONLY
+	}
+	file, err := os.OpenFile(imagePath, mode, 0)
+	if err != nil {
+		return err
+	}
+	d.File = file
+
+	buffer := make([]byte, 512)
+	// 读取镜像的前512字节，即BPR
+	bytesRead, err := d.File.ReadAt(buffer, 0)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return err
+	}
+	if bytesRead != 512 {
+		return errors.New("read sector error")
+	}
+	d.BPRSector, err = parseBPR(buffer)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (d *ImageDriver) ReadSector(sectorNum uint64, readNum uint16) ([]byte, error) {
+	buffer := make([]byte, int(d.BPRSector.BytesPerSector)*int(readNum))
+	offsetByte := int64(d.BPRSector.BytesPerSector) * int64(sectorNum)
+
+	bytesRead, err := d.File.ReadAt(buffer, offsetByte)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+	return buffer[:bytesRead], nil
+}
+
+func (d *ImageDriver) WriteData(data []byte, sectorNum uint64, offset uint16) error {
+	offsetByte := int64(offset) + int64(sectorNum)*int64(d.BPRSector.BytesPerSector)
+	_, err := d.File.WriteAt(data, offsetByte)
+	return err
+}
+
+func (d *ImageDriver) Sync() error {
+	return d.File.Sync()
+}
+
+func (d *ImageDriver) DDestroy() error {
+	return d.File.Close()
+}
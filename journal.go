@@ -0,0 +1,306 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+)
+
+// 删除操作的各个阶段，每个阶段完成并同步到设备后写入日志
+const (
+	journalBegin  = "begin"  // 已记录计划，尚未写入设备
+	journalWiped  = "wiped"  // 文件内容已覆写
+	journalFreed  = "freed"  // FAT表与FSInfo已更新
+	journalCommit = "commit" // 目录项已删除，操作完成
+)
+
+// JournalRecord 预写日志中的一条记录，begin 记录包含完整的写入计划
+type JournalRecord struct {
+	Op     string
+	Seq    int
+	Image  string       `json:",omitempty"`
+	Target string       `json:",omitempty"`
+	Serial uint32       `json:",omitempty"` // 卷序列号，恢复时确认为同一个卷
+	Dirty  bool         `json:",omitempty"` // 卷在操作前已被标记为脏，恢复后保留脏标记
+	Wipe   *WipeProfile `json:",omitempty"`
+	Plan   *FilePlan    `json:",omitempty"`
+}
+
+// PendingJournalError 日志中存在被中断的操作，需要先执行 recover-journal
+type PendingJournalError struct {
+	Path string
+}
+
+func (e *PendingJournalError) Error() string {
+	return fmt.Sprintf("journal %s has interrupted operations, run recover-journal first", e.Path)
+}
+
+// Journal 宿主机上的预写日志，在修改FAT表与目录项之前记录预期的修改
+type Journal struct {
+	Path   string
+	Image  string
+	Target string
+	file   *os.File
+	seq    int
+}
+
+// DefaultJournalPath 默认日志路径，位于用户配置目录，重启后仍然保留
+func DefaultJournalPath() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		dir = os.TempDir()
+	}
+	return filepath.Join(dir, "FAT32-SecRm", "journal.jsonl")
+}
+
+// OpenJournal 打开预写日志，存在未完成的操作时返回 PendingJournalError
+func OpenJournal(path, image, target string) (*Journal, error) {
+	records, err := readJournal(path)
+	if err != nil {
+		return nil, err
+	}
+	if len(pendingOps(records)) > 0 {
+		return nil, &PendingJournalError{Path: path}
+	}
+	err = os.MkdirAll(filepath.Dir(path), 0o700)
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	return &Journal{Path: path, Image: image, Target: target, file: file}, nil
+}
+
+// openJournal 依据删除选项打开预写日志，仅输出计划时不记录日志
+func openJournal(opts *RemoveOptions, image, target string) error {
+	if opts.JournalPath == "" || opts.DryRun {
+		return nil
+	}
+	journal, err := OpenJournal(opts.JournalPath, image, target)
+	if err != nil {
+		return err
+	}
+	opts.Journal = journal
+	return nil
+}
+
+// append 追加一条记录并同步到宿主机磁盘
+func (j *Journal) append(record *JournalRecord) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	_, err = j.file.Write(append(data, '\n'))
+	if err != nil {
+		return err
+	}
+	return j.file.Sync()
+}
+
+// Begin 在写入设备前记录本次删除的完整计划，path 为恢复时输出的显示路径，日志为空时不做任何事
+func (j *Journal) Begin(vol *Volume, opts *RemoveOptions, path string, dEntry *FAT32DirEntry, chain []uint32, dEntryOffsets []*DirEntryOffset) error {
+	if j == nil {
+		return nil
+	}
+	plans, err := newPlanner(vol, opts)
+	if err != nil {
+		return err
+	}
+	plan, err := plans.planRemoveChain(path, dEntry, chain, dEntryOffsets)
+	if err != nil {
+		return err
+	}
+	j.seq++
+	return j.append(&JournalRecord{
+		Op:     journalBegin,
+		Seq:    j.seq,
+		Image:  j.Image,
+		Target: j.Target,
+		Serial: vol.BPRSector.VolumeSerialNumber,
+		Dirty:  vol.KeepDirty,
+		Wipe:   &opts.Wiper.Profile,
+		Plan:   plan,
+	})
+}
+
+// Phase 将设备上已写入的数据同步后，记录当前操作进入下一阶段
+func (j *Journal) Phase(vol *Volume, op string) error {
+	if j == nil {
+		return nil
+	}
+	err := syncDriver(vol.Driver)
+	if err != nil {
+		return err
+	}
+	return j.append(&JournalRecord{Op: op, Seq: j.seq})
+}
+
+// Close 所有操作完成后删除日志
+func (j *Journal) Close() error {
+	if j == nil {
+		return nil
+	}
+	err := j.file.Close()
+	if err != nil {
+		return err
+	}
+	return os.Remove(j.Path)
+}
+
+// readJournal 读取日志中的全部记录，日志不存在时返回空
+func readJournal(path string) ([]*JournalRecord, error) {
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	var records []*JournalRecord
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(nil, 64<<20)
+	for scanner.Scan() {
+		var record JournalRecord
+		// 断电时最后一条记录可能不完整，忽略无法解析的行
+		if json.Unmarshal(scanner.Bytes(), &record) != nil {
+			break
+		}
+		records = append(records, &record)
+	}
+	return records, scanner.Err()
+}
+
+// pendingOp 被中断的操作及其最后完成的阶段
+type pendingOp struct {
+	begin *JournalRecord
+	phase string
+}
+
+// pendingOps 返回所有没有 commit 记录的操作
+func pendingOps(records []*JournalRecord) []*pendingOp {
+	ops := make(map[int]*pendingOp)
+	var order []int
+	for _, record := range records {
+		if record.Op == journalBegin {
+			ops[record.Seq] = &pendingOp{begin: record, phase: journalBegin}
+			order = append(order, record.Seq)
+		} else if op, ok := ops[record.Seq]; ok {
+			op.phase = record.Op
+		}
+	}
+	var pending []*pendingOp
+	for _, seq := range order {
+		if ops[seq].phase != journalCommit {
+			pending = append(pending, ops[seq])
+		}
+	}
+	return pending
+}
+
+// applyPlannedWrites 将计划中指定类型的元数据写入设备，rollback 为真时写回原内容
+func applyPlannedWrites(vol *Volume, plan *FilePlan, kinds []string, rollback bool) error {
+	bytesPerSector := uint64(vol.BPRSector.BytesPerSector)
+	for _, kind := range kinds {
+		for _, write := range plan.Writes {
+			if write.Kind != kind {
+				continue
+			}
+			buf, err := vol.Driver.ReadSector(write.Sector, 1)
+			if err != nil {
+				return err
+			}
+			if uint64(write.Offset)+write.Length > bytesPerSector {
+				return fmt.Errorf("journal write at sector %d crosses sector boundary", write.Sector)
+			}
+			data := write.New
+			if rollback {
+				data = write.Old
+			}
+			copy(buf[write.Offset:], data)
+			err = vol.writeMeta(buf, write.Sector)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	// FAT表项未经缓存直接写入，丢弃缓存以免之后写回旧内容
+	vol.fat.invalidate()
+	return syncDriver(vol.Driver)
+}
+
+// recoverOp 恢复一个被中断的操作
+// 重放：补全剩余阶段，内容覆写未完成时重新覆写；回滚：写回FAT表、FSInfo与目录项的原内容
+// 已覆写的文件内容无法恢复，回滚后文件仍然存在但内容可能已被清除
+func recoverOp(op *pendingOp, rollback bool) error {
+	begin := op.begin
+	driver, vol, _, err := openPlanTarget(begin.Image, begin.Target, false)
+	if err != nil {
+		return err
+	}
+	if vol.BPRSector.VolumeSerialNumber != begin.Serial {
+		_ = driver.DDestroy()
+		return fmt.Errorf("volume serial %08x does not match journal %08x", vol.BPRSector.VolumeSerialNumber, begin.Serial)
+	}
+	// 中断的操作已将卷标记为脏，恢复完成后再清除
+	vol.KeepDirty = begin.Dirty
+	err = markDirty(vol)
+	if err != nil {
+		return err
+	}
+
+	if rollback {
+		log.Printf("Rolling back %s (interrupted after %s)", begin.Plan.Path, op.phase)
+		err = applyPlannedWrites(vol, begin.Plan, []string{"dentry", "fsinfo", "fat"}, true)
+	} else {
+		log.Printf("Replaying %s (interrupted after %s)", begin.Plan.Path, op.phase)
+		if op.phase == journalBegin && len(begin.Plan.Chain) > 0 {
+			wiper, err := NewWiper(*begin.Wipe, nil)
+			if err != nil {
+				return err
+			}
+			err = cleanFileContent(vol, &RemoveOptions{Wiper: wiper}, begin.Plan.Chain)
+			if err != nil {
+				return err
+			}
+		}
+		err = applyPlannedWrites(vol, begin.Plan, []string{"fat", "fsinfo", "dentry"}, false)
+	}
+	if err != nil {
+		return err
+	}
+	err = markClean(vol)
+	if err != nil {
+		return err
+	}
+	return driver.DDestroy()
+}
+
+// RecoverJournal 重放或回滚日志中所有被中断的操作，完成后删除日志
+func RecoverJournal(path string, rollback bool) error {
+	records, err := readJournal(path)
+	if err != nil {
+		return err
+	}
+	pending := pendingOps(records)
+	if len(pending) == 0 {
+		log.Println("No interrupted operation in", path)
+	}
+	for _, op := range pending {
+		err = recoverOp(op, rollback)
+		if err != nil {
+			return err
+		}
+	}
+	err = os.Remove(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
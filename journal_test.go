@@ -0,0 +1,159 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+// crashDriver 在完成指定次数的写入后失败，模拟写入过程中断电
+type crashDriver struct {
+	*ImageDriver
+	writes int
+}
+
+var errCrash = errors.New("simulated power loss")
+
+func (d *crashDriver) WriteData(data []byte, sectorNum uint64, offset uint16) error {
+	if d.writes == 0 {
+		return errCrash
+	}
+	d.writes--
+	return d.ImageDriver.WriteData(data, sectorNum, offset)
+}
+
+// openImage 打开镜像并返回卷，测试结束时关闭
+func openImage(t *testing.T, path string) *Volume {
+	t.Helper()
+	driver := &ImageDriver{}
+	err := driver.DInit(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = driver.DDestroy() })
+	vol, err := NewVolume(driver)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return vol
+}
+
+// crashRemove 删除文件，在第 writes 次写入时中断，返回是否被中断
+func crashRemove(t *testing.T, image, journalPath, path string, writes int) bool {
+	t.Helper()
+	driver := &ImageDriver{}
+	err := driver.DInit(image)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer driver.DDestroy()
+	vol, err := NewVolume(&crashDriver{ImageDriver: driver, writes: writes})
+	if err != nil {
+		t.Fatal(err)
+	}
+	wiper, _ := NewWiper(WipeProfiles["zero"], nil)
+	opts := &RemoveOptions{Wiper: wiper, JournalPath: journalPath}
+	err = openJournal(opts, image, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dEntry, dEntryOffset := lookup(t, vol, path)
+	err = doRemoveFile(vol, opts, path, dEntry, dEntryOffset)
+	if errors.Is(err, errCrash) {
+		return true
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return false
+}
+
+// volumeState 返回FSInfo、文件簇的FAT表项与目录项首字节
+func volumeState(t *testing.T, vol *Volume, clusters []uint32, offsets []*DirEntryOffset) []byte {
+	t.Helper()
+	var state []byte
+	fsInfo, err := readFSInfo(vol)
+	if err != nil {
+		t.Fatal(err)
+	}
+	state = append(state, fsInfo[fsInfoFreeCount:fsInfoNextFree+4]...)
+	bps := uint32(vol.BPRSector.BytesPerSector)
+	for _, fat := range vol.fatCopies() {
+		for _, cluster := range clusters {
+			buf, _ := vol.Driver.ReadSector(vol.fatCopySector(fat, cluster/(bps/4)), 1)
+			state = append(state, buf[cluster%(bps/4)*4:cluster%(bps/4)*4+4]...)
+		}
+	}
+	for _, offset := range offsets {
+		buf, _ := vol.Driver.ReadSector(vol.dEntrySector(offset), 1)
+		state = append(state, buf[offset.Offset%bps])
+	}
+	return state
+}
+
+func TestRecoverJournal(t *testing.T) {
+	b := NewVolumeBuilder(512, 1)
+	entry := b.AddFileAt("Secret Notes.txt", fill(1500, 1), 10, 11, 600)
+	driver, err := b.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 完整删除后的状态
+	done := saveImage(t, driver)
+	vol := openImage(t, done)
+	before := volumeState(t, vol, entry.Clusters, entry.Offsets)
+	if crashRemove(t, done, filepath.Join(t.TempDir(), "journal"), entry.Name, -1) {
+		t.Fatal("removal without crash was interrupted")
+	}
+	after := volumeState(t, openImage(t, done), entry.Clusters, entry.Offsets)
+
+	for writes := 0; ; writes++ {
+		image := saveImage(t, driver)
+		journalPath := filepath.Join(t.TempDir(), "journal")
+		if !crashRemove(t, image, journalPath, entry.Name, writes) {
+			break
+		}
+		var pending *PendingJournalError
+		if _, err := OpenJournal(journalPath, image, entry.Name); !errors.As(err, &pending) {
+			t.Fatalf("writes %d: reopen journal: %v", writes, err)
+		}
+
+		// 日志记录显示路径，恢复时可以说明被中断的是哪个文件
+		records, err := readJournal(journalPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ops := pendingOps(records); len(ops) != 1 || ops[0].begin.Plan.Path != entry.Name {
+			t.Errorf("writes %d: journal does not record path %q", writes, entry.Name)
+		}
+
+		rollback := writes%2 == 1
+		err = RecoverJournal(journalPath, rollback)
+		if err != nil {
+			t.Fatalf("writes %d: %v", writes, err)
+		}
+		vol := openImage(t, image)
+		want := after
+		if rollback {
+			want = before
+		}
+		if got := volumeState(t, vol, entry.Clusters, entry.Offsets); !bytes.Equal(got, want) {
+			t.Errorf("writes %d rollback %v: state %x, want %x", writes, rollback, got, want)
+		}
+		if flags, _ := volumeFlags(vol); flags&fatCleanShutdown == 0 {
+			t.Errorf("writes %d: volume left dirty after recovery", writes)
+		}
+		if !rollback {
+			for _, cluster := range entry.Clusters {
+				if !bytes.Equal(readCluster(t, vol, cluster), make([]byte, 512)) {
+					t.Errorf("writes %d: cluster %d not wiped after replay", writes, cluster)
+				}
+			}
+		}
+		if _, err := OpenJournal(journalPath, image, entry.Name); err != nil {
+			t.Errorf("writes %d: journal not cleared: %v", writes, err)
+		}
+	}
+}
@@ -4,8 +4,6 @@ package main
 
 import (
 	"bufio"
-	"bytes"
-	"encoding/binary"
 	"errors"
 	"golang.org/x/sys/unix"
 	"os"
@@ -19,7 +17,7 @@ type DefaultDriver struct {
 	Fd        int
 	Prefix    string
 	BPRSector *FAT32BootSector
-	Offset    *FAT32Offset
+	ReadOnly  bool // 只读打开设备，用于 dry-run
 }
 
 func (d *DefaultDriver) DInit(absFileName string) error {
@@ -28,7 +26,16 @@ func (d *DefaultDriver) DInit(absFileName string) error {
 		return err
 	}
 	d.Prefix = mountPoint
-	fd, err := openFd(device)
+	// 挂载的文件系统必须为vfat
+	var stat unix.Statfs_t
+	err = unix.Statfs(mountPoint, &stat)
+	if err != nil {
+		return err
+	}
+	if stat.Type != unix.MSDOS_SUPER_MAGIC {
+		return invalidVolume("%s is not mounted as vfat (magic %#x)", mountPoint, stat.Type)
+	}
+	fd, err := openFd(device, d.ReadOnly)
 	if err != nil {
 		return err
 	}
@@ -38,15 +45,11 @@ func (d *DefaultDriver) DInit(absFileName string) error {
 	if err != nil {
 		return err
 	}
-	// 初始化计算重要偏移处
-	d.Offset = &FAT32Offset{}
-	d.Offset.DEntry = uint(d.BPRSector.ReservedSectors)
-	d.Offset.Data = uint32(d.Offset.DEntry) + 2*uint32(d.BPRSector.SectorsPerFAT32)
-	return UpdateFAT(d, 0)
+	return nil
 }
 
 func (d *DefaultDriver) ReadSector(sectorNum uint64, readNum uint16) ([]byte, error) {
-	bufferSize := d.BPRSector.BytesPerSector * readNum
+	bufferSize := int(d.BPRSector.BytesPerSector) * int(readNum)
 
 	buffer := make([]byte, bufferSize)
 
@@ -70,6 +73,25 @@ func (d *DefaultDriver) WriteData(data []byte, sectorNum uint64, offset uint16)
 	return nil
 }
 
+func (d *DefaultDriver) Sync() error {
+	return unix.Fsync(d.Fd)
+}
+
+// ReadSectorDirect 同步并丢弃页缓存后读取扇区，确保读到设备上的实际内容
+func (d *DefaultDriver) ReadSectorDirect(sectorNum uint64, readNum uint16) ([]byte, error) {
+	err := unix.Fsync(d.Fd)
+	if err != nil {
+		return nil, err
+	}
+	offsetByte := int64(d.BPRSector.BytesPerSector) * int64(sectorNum)
+	length := int64(d.BPRSector.BytesPerSector) * int64(readNum)
+	err = unix.Fadvise(d.Fd, offsetByte, length, unix.FADV_DONTNEED)
+	if err != nil {
+		return nil, err
+	}
+	return d.ReadSector(sectorNum, readNum)
+}
+
 func (d *DefaultDriver) DDestroy() error {
 	return unix.Close(d.Fd)
 }
@@ -123,8 +145,12 @@ func getMount(absFileName string) (string, string, error) {
 	return devices[index], bestMatch, nil
 }
 
-func openFd(mountPoint string) (int, error) {
-	fd, err := unix.Open(mountPoint, unix.O_RDWR, 0)
+func openFd(mountPoint string, readOnly bool) (int, error) {
+	mode := unix.O_RDWR
+	if readOnly {
+		mode = unix.O_RDONLY
+	}
+	fd, err := unix.Open(mountPoint, mode, 0)
 	if err != nil {
 		return -1, err
 	}
@@ -141,10 +167,5 @@ func getBPR(fd int) (*FAT32BootSector, error) {
 	if bytesRead != 512 {
 		return nil, errors.New("read sector error")
 	}
-	var fat32BootSector FAT32BootSector
-	err = binary.Read(bytes.NewReader(buffer[:bytesRead]), binary.LittleEndian, &fat32BootSector)
-	if err != nil {
-		return nil, err
-	}
-	return &fat32BootSector, nil
+	return parseBPR(buffer[:bytesRead])
 }
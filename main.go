@@ -2,12 +2,127 @@ package main
 
 import (
 	"errors"
+	"fmt"
 	"github.com/urfave/cli/v2"
 	"log"
 	"os"
 	"runtime"
+	"strings"
 )
 
+var imageFlag = &cli.StringFlag{
+	Name:    "image",
+	Aliases: []string{"i"},
+	Usage:   "operate on FAT32 image `FILE`, path is relative to volume root",
+}
+
+var verifyFlag = &cli.BoolFlag{
+	Name:  "verify",
+	Usage: "read back every wiped cluster and modified metadata sector",
+}
+
+var forceFlag = &cli.BoolFlag{
+	Name:  "force",
+	Usage: "operate on a volume that is already marked dirty",
+}
+
+var codePageFlag = &cli.StringFlag{
+	Name:  "codepage",
+	Value: DefaultCodePage.Name,
+	Usage: "OEM code page of short names, as the vfat codepage= mount option: " + strings.Join(CodePageNames(), ", "),
+}
+
+var salvageFlag = &cli.BoolFlag{
+	Name:  "salvage",
+	Usage: "on a corrupt cluster chain, wipe and free only the clusters not shared with other files instead of failing",
+}
+
+// journalFlags 预写日志相关的选项
+var journalFlags = []cli.Flag{
+	&cli.StringFlag{
+		Name:  "journal",
+		Value: DefaultJournalPath(),
+		Usage: "write-ahead journal `FILE` on the host",
+	},
+	&cli.BoolFlag{
+		Name:  "no-journal",
+		Usage: "do not record a write-ahead journal",
+	},
+}
+
+// journalPath 依据命令行选项返回预写日志路径，禁用日志时为空
+func journalPath(c *cli.Context) string {
+	if c.Bool("no-journal") {
+		return ""
+	}
+	return c.String("journal")
+}
+
+// wipeFlags 覆写方式相关的选项
+var wipeFlags = []cli.Flag{
+	&cli.StringFlag{
+		Name:    "standard",
+		Aliases: []string{"s"},
+		Value:   "zero",
+		Usage:   "wipe standard: " + strings.Join(WipeProfileNames(), ", "),
+	},
+	&cli.StringFlag{
+		Name:  "pattern",
+		Usage: "custom wipe passes separated by comma, e.g. `0x00,0xff,random`",
+	},
+	&cli.BoolFlag{
+		Name:  "final-verify",
+		Usage: "read back and verify the final wipe pass",
+	},
+	&cli.StringFlag{
+		Name:  "seed",
+		Usage: "seed for random passes, for reproducible output",
+	},
+	&cli.IntFlag{
+		Name:  "buffer-size",
+		Value: DefaultWipeBufferSize >> 10,
+		Usage: "largest single write in `KiB`, contiguous clusters are wiped in writes of up to this size",
+	},
+	&cli.BoolFlag{
+		Name:  "scrub-entries",
+		Usage: "overwrite the whole short and long name entries, not only the first byte",
+	},
+}
+
+// removeOptions 依据命令行选项构建删除选项
+func removeOptions(c *cli.Context) (*RemoveOptions, error) {
+	profile, err := ParseWipeProfile(c.String("standard"), c.String("pattern"), c.Bool("final-verify"))
+	if err != nil {
+		return nil, err
+	}
+	wiper, err := NewWiper(profile, ParseSeed(c.String("seed")))
+	if err != nil {
+		return nil, err
+	}
+	if c.Int("buffer-size") <= 0 {
+		return nil, fmt.Errorf("invalid buffer size %d KiB", c.Int("buffer-size"))
+	}
+	wiper.BufferSize = c.Int("buffer-size") << 10
+	// 不涉及文件名的命令没有 --codepage 选项
+	codePage := DefaultCodePage
+	if c.String("codepage") != "" {
+		codePage, err = ParseCodePage(c.String("codepage"))
+		if err != nil {
+			return nil, err
+		}
+	}
+	return &RemoveOptions{
+		Wiper:        wiper,
+		Verify:       c.Bool("verify"),
+		DryRun:       c.Bool("dry-run"),
+		Force:        c.Bool("force"),
+		ScrubEntries: c.Bool("scrub-entries"),
+		JournalPath:  journalPath(c),
+		CodePage:     codePage,
+		Salvage:      c.Bool("salvage"),
+	}, nil
+}
+
 func main() {
 	// 创建一个 CLI 应用
 	app := &cli.App{
@@ -20,17 +135,147 @@ func main() {
 				Name:    "remove",
 				Aliases: []string{"r"},
 				Usage:   "remove file or directory",
+				Flags: append([]cli.Flag{
+					imageFlag,
+					&cli.BoolFlag{
+						Name:  "dry-run",
+						Usage: "print every sector write without opening the device for write",
+					},
+					verifyFlag,
+					forceFlag,
+					codePageFlag,
+					salvageFlag,
+				}, append(journalFlags, wipeFlags...)...),
 				Action: func(c *cli.Context) error {
 					// 解析参数
 					absFileName := c.Args().Get(0)
+					opts, err := removeOptions(c)
+					if err != nil {
+						return err
+					}
+					// 镜像文件无需挂载，与平台无关
+					if c.IsSet("image") {
+						return RemoveImageFile(c.String("image"), absFileName, opts)
+					}
 					switch runtime.GOOS {
 					case "windows", "linux":
-						return RemoveFile(absFileName)
+						return RemoveFile(absFileName, opts)
 					default:
 						return errors.New("not support right now")
 					}
 				},
 			},
+			{
+				Name:      "compact",
+				Usage:     "move live directory entries forward, zero the tail and free unused directory clusters of an unmounted volume given with --image",
+				ArgsUsage: "DIR",
+				Flags:     append([]cli.Flag{imageFlag, verifyFlag, forceFlag, codePageFlag}, wipeFlags...),
+				Action: func(c *cli.Context) error {
+					opts, err := removeOptions(c)
+					if err != nil {
+						return err
+					}
+					return CompactDir(c.String("image"), c.Args().Get(0), opts)
+				},
+			},
+			{
+				Name:      "wipe-free",
+				Usage:     "overwrite every free cluster of the volume",
+				ArgsUsage: "[PATH]",
+				Flags: append([]cli.Flag{
+					imageFlag,
+					verifyFlag,
+					forceFlag,
+					&cli.StringFlag{
+						Name:  "state",
+						Usage: "progress `FILE` used to resume an interrupted run",
+					},
+					&cli.BoolFlag{
+						Name:  "restart",
+						Usage: "ignore saved progress and start from the first cluster",
+					},
+				}, wipeFlags...),
+				Action: func(c *cli.Context) error {
+					opts, err := removeOptions(c)
+					if err != nil {
+						return err
+					}
+					return WipeFree(c.String("image"), c.Args().Get(0), opts, c.String("state"), c.Bool("restart"))
+				},
+			},
+			{
+				Name:      "wipe-slack",
+				Usage:     "overwrite the bytes past end-of-file in the last cluster of each file and the unused tail of each directory",
+				ArgsUsage: "[PATH]",
+				Flags:     append([]cli.Flag{imageFlag, verifyFlag, forceFlag, codePageFlag}, wipeFlags...),
+				Action: func(c *cli.Context) error {
+					opts, err := removeOptions(c)
+					if err != nil {
+						return err
+					}
+					return WipeSlack(c.String("image"), c.Args().Get(0), opts)
+				},
+			},
+			{
+				Name:      "scrub-deleted-entries",
+				Usage:     "overwrite deleted and orphaned long name entries in every directory and report what was recoverable",
+				ArgsUsage: "[PATH]",
+				Flags:     []cli.Flag{imageFlag, verifyFlag, forceFlag, codePageFlag},
+				Action: func(c *cli.Context) error {
+					codePage, err := ParseCodePage(c.String("codepage"))
+					if err != nil {
+						return err
+					}
+					opts := &RemoveOptions{Verify: c.Bool("verify"), Force: c.Bool("force"), CodePage: codePage}
+					return ScrubDeletedEntries(c.String("image"), c.Args().Get(0), opts, os.Stdout)
+				},
+			},
+			{
+				Name:      "plan",
+				Usage:     "write the removal plan of file or directory to a JSON file for review",
+				ArgsUsage: "PATH",
+				Flags: append([]cli.Flag{
+					imageFlag,
+					codePageFlag,
+					salvageFlag,
+					&cli.StringFlag{
+						Name:     "output",
+						Aliases:  []string{"o"},
+						Usage:    "plan `FILE` to write",
+						Required: true,
+					},
+				}, wipeFlags...),
+				Action: func(c *cli.Context) error {
+					opts, err := removeOptions(c)
+					if err != nil {
+						return err
+					}
+					return PlanRemove(c.String("image"), c.Args().Get(0), opts, c.String("output"))
+				},
+			},
+			{
+				Name:      "apply",
+				Usage:     "apply a reviewed removal plan, refuse if the volume changed since planning",
+				ArgsUsage: "PLAN",
+				Flags:     append([]cli.Flag{verifyFlag, forceFlag}, journalFlags...),
+				Action: func(c *cli.Context) error {
+					return ApplyPlan(c.Args().Get(0), c.Bool("verify"), c.Bool("force"), journalPath(c))
+				},
+			},
+			{
+				Name:  "recover-journal",
+				Usage: "replay or roll back removals interrupted by a crash or power loss",
+				Flags: []cli.Flag{
+					journalFlags[0],
+					&cli.BoolFlag{
+						Name:  "rollback",
+						Usage: "restore FAT, FSInfo and directory entries instead of completing the removal",
+					},
+				},
+				Action: func(c *cli.Context) error {
+					return RecoverJournal(c.String("journal"), c.Bool("rollback"))
+				},
+			},
 		},
 	}
 
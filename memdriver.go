@@ -0,0 +1,96 @@
+package main
+
+import (
+	"errors"
+	"sort"
+)
+
+// MemDriver 基于内存的稀疏驱动器，仅保存写入过的扇区，未写入的扇区读出为0
+// 主要用于测试，也可作为内存磁盘使用
+type MemDriver struct {
+	BytesPerSector uint16
+	TotalSectors   uint64
+	sectors        map[uint64][]byte
+}
+
+// NewMemDriver 创建指定扇区大小与扇区总数的内存驱动器
+func NewMemDriver(bytesPerSector uint16, totalSectors uint64) *MemDriver {
+	return &MemDriver{
+		BytesPerSector: bytesPerSector,
+		TotalSectors:   totalSectors,
+		sectors:        make(map[uint64][]byte),
+	}
+}
+
+func (d *MemDriver) DInit(string) error {
+	if d.BytesPerSector == 0 {
+		return errors.New("bytes per sector not set")
+	}
+	if d.sectors == nil {
+		d.sectors = make(map[uint64][]byte)
+	}
+	return nil
+}
+
+func (d *MemDriver) ReadSector(sectorNum uint64, readNum uint16) ([]byte, error) {
+	if sectorNum >= d.TotalSectors {
+		return nil, errors.New("read beyond end of device")
+	}
+	// 与文件读取一致，超出设备末尾的部分截断
+	if sectorNum+uint64(readNum) > d.TotalSectors {
+		readNum = uint16(d.TotalSectors - sectorNum)
+	}
+	size := uint64(d.BytesPerSector)
+	buffer := make([]byte, uint64(readNum)*size)
+	for i := uint64(0); i < uint64(readNum); i++ {
+		if sector, ok := d.sectors[sectorNum+i]; ok {
+			copy(buffer[i*size:], sector)
+		}
+	}
+	return buffer, nil
+}
+
+func (d *MemDriver) WriteData(data []byte, sectorNum uint64, offset uint16) error {
+	size := uint64(d.BytesPerSector)
+	start := sectorNum*size + uint64(offset)
+	if start+uint64(len(data)) > d.TotalSectors*size {
+		return errors.New("write beyond end of device")
+	}
+	for len(data) > 0 {
+		num, inner := start/size, start%size
+		sector, ok := d.sectors[num]
+		if !ok {
+			sector = make([]byte, size)
+			d.sectors[num] = sector
+		}
+		n := copy(sector[inner:], data)
+		data = data[n:]
+		start += uint64(n)
+	}
+	return nil
+}
+
+func (d *MemDriver) DDestroy() error {
+	return nil
+}
+
+// Clone 深拷贝当前磁盘内容，便于比较操作前后的差异
+func (d *MemDriver) Clone() *MemDriver {
+	c := NewMemDriver(d.BytesPerSector, d.TotalSectors)
+	for num, sector := range d.sectors {
+		c.sectors[num] = append([]byte(nil), sector...)
+	}
+	return c
+}
+
+// Sectors 返回所有写入过的扇区号，升序排列
+func (d *MemDriver) Sectors() []uint64 {
+	nums := make([]uint64, 0, len(d.sectors))
+	for num := range d.sectors {
+		nums = append(nums, num)
+	}
+	sort.Slice(nums, func(i, j int) bool {
+		return nums[i] < nums[j]
+	})
+	return nums
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"golang.org/x/text/unicode/norm"
+	"path"
+	"strings"
+	"unicode/utf8"
+)
+
+// Windows NT 在短文件名目录项0x0C字节中记录全小写的主文件名与拓展名，此时不生成长文件名项
+const (
+	caseLowerBase = 0x08
+	caseLowerExt  = 0x10
+)
+
+// splitVolumePath 将卷内路径拆分为各级文件名，/ 与 \ 均视为分隔符
+// 与 Windows 一致，忽略空路径段与 "."，".." 返回上级目录，去除文件名末尾的点与空格
+func splitVolumePath(filePath string) []string {
+	filePath = path.Clean("/" + strings.ReplaceAll(filePath, `\`, "/"))
+	var names []string
+	for _, name := range strings.Split(filePath, "/") {
+		name = strings.TrimRight(name, ". ")
+		if name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// displayName 返回用于显示与输出的长文件名，统一为 NFC 形式
+// macOS 写入的文件名为 NFD 形式，Windows 与 Linux 通常为 NFC 形式
+func displayName(longName string) string {
+	return norm.NFC.String(longName)
+}
+
+// longNameEqual 长文件名比较，两侧均规范化为 NFC 形式，与 Windows 和 Linux vfat 一致不区分大小写
+// 含有无效 UTF-16 代理项的长文件名解码后无法确定原字符，不参与比较，只能以短文件名别名匹配
+func longNameEqual(longName, fileName string) bool {
+	if longName == "" || strings.ContainsRune(longName, utf8.RuneError) {
+		return false
+	}
+	return strings.EqualFold(norm.NFC.String(longName), norm.NFC.String(fileName))
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSplitVolumePath(t *testing.T) {
+	for path, want := range map[string][]string{
+		`/docs/a.txt`:         {"docs", "a.txt"},
+		`docs\sub\a.txt`:      {"docs", "sub", "a.txt"},
+		`\docs//./sub\..\b. `: {"docs", "b"},
+		`/../docs/`:           {"docs"},
+		`/`:                   nil,
+		`.`:                   nil,
+	} {
+		if got := splitVolumePath(path); !reflect.DeepEqual(got, want) {
+			t.Errorf("%q: got %q, want %q", path, got, want)
+		}
+	}
+}
+
+func TestResolvePath(t *testing.T) {
+	b := NewVolumeBuilder(512, 1)
+	app := b.AddFile("Program Files/App.exe", fill(100, 1))
+	makefile := b.AddFile("Makefile", fill(100, 2))
+	readme := b.AddFile("README", fill(100, 3))
+	lower := b.AddFile("readme.txt", fill(100, 4))
+	lower.ShortName, lower.Case = dirEntryName("README", "TXT"), caseLowerBase|caseLowerExt
+	mixed := b.AddFile("notes.TXT", fill(100, 5))
+	mixed.ShortName, mixed.Case = dirEntryName("NOTES", "TXT"), caseLowerBase
+	_, vol := buildVolume(t, b)
+
+	for _, c := range []struct {
+		path  string
+		entry *BuildEntry
+	}{
+		{"Program Files/App.exe", app},
+		{"program files/APP.EXE", app},
+		{`PROGRA~1\APP~1.EXE`, app},
+		{`\Program Files\.\..\Program Files\App.exe`, app},
+		{"Makefile", makefile},
+		{"MAKEFILE", makefile},
+		{"makefile.", makefile},
+		{"readme", readme},
+		{"readme.txt", lower},
+		{"README.TXT", lower},
+		{"Notes.txt", mixed},
+	} {
+		_, offsets, err := getDirEntry(vol, c.path)
+		if err != nil {
+			t.Errorf("%s: %v", c.path, err)
+			continue
+		}
+		// 以短文件名别名匹配时长文件名项同样返回
+		if !reflect.DeepEqual(offsets, c.entry.Offsets) {
+			t.Errorf("%s: offsets do not match %s", c.path, c.entry.Name)
+		}
+	}
+	for _, path := range []string{"readme.md", "README/x", "Program Files/App", "PROGRA~2", "/", ""} {
+		if _, _, err := getDirEntry(vol, path); err == nil {
+			t.Errorf("%q: found", path)
+		}
+	}
+
+	items, err := listDir(vol, vol.BPRSector.RootCluster)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, item := range items {
+		names = append(names, item.Name)
+	}
+	if want := []string{"Program Files", "Makefile", "README", "readme.txt", "notes.TXT"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("listDir names %q, want %q", names, want)
+	}
+	if len(lower.Offsets) != 1 || len(mixed.Offsets) != 1 {
+		t.Error("names stored by case flags should not have long name entries")
+	}
+}
+
+func TestResolveUnicodeNames(t *testing.T) {
+	b := NewVolumeBuilder(512, 1)
+	nfd := b.AddFile("Cafe\u0301 Menu.txt", fill(10, 1))
+	dupNFC := b.AddFile("dup/Résumé.txt", fill(10, 2))
+	dupNFD := b.AddFile("dup/Re\u0301sume\u0301.txt", fill(10, 3))
+	padded := b.AddFile("Padded.txt", fill(10, 4))
+	emoji := b.AddFile("Emoji \U0001F600 Note.txt", fill(10, 5))
+	_, vol := buildVolume(t, b)
+
+	// 以0xFFFF代替结束符，低位代理项替换为 'X'
+	patchEntry(t, vol, padded.Offsets[0], 24, 0xff)
+	patchEntry(t, vol, padded.Offsets[0], 25, 0xff)
+	patchEntry(t, vol, emoji.Offsets[1], 18, 'X')
+	patchEntry(t, vol, emoji.Offsets[1], 19, 0)
+
+	for _, c := range []struct {
+		path  string
+		entry *BuildEntry
+	}{
+		{"Café Menu.txt", nfd},
+		{"CAFÉ MENU.TXT", nfd},
+		{"dup/Résumé.txt", dupNFC},
+		{"dup/Re\u0301sume\u0301.txt", dupNFD},
+		{"padded.TXT", padded},
+	} {
+		_, offsets, err := getDirEntry(vol, c.path)
+		if err != nil {
+			t.Errorf("%s: %v", c.path, err)
+		} else if !reflect.DeepEqual(offsets, c.entry.Offsets) {
+			t.Errorf("%s: offsets do not match %s", c.path, c.entry.Name)
+		}
+	}
+	if _, _, err := getDirEntry(vol, "dup/RÉSUMÉ.TXT"); err == nil {
+		t.Error("ambiguous name resolved")
+	}
+
+	items, err := listDir(vol, vol.BPRSector.RootCluster)
+	if err != nil {
+		t.Fatal(err)
+	}
+	byEntry := make(map[*BuildEntry]*DirItem)
+	for _, item := range items {
+		for _, entry := range []*BuildEntry{nfd, padded, emoji} {
+			if reflect.DeepEqual(item.Offsets, entry.Offsets) {
+				byEntry[entry] = item
+			}
+		}
+	}
+	if item := byEntry[nfd]; item == nil || item.Name != "Café Menu.txt" || item.LongName != nfd.Name {
+		t.Errorf("NFD name listed as %+v", item)
+	}
+	if item := byEntry[padded]; item == nil || item.Name != "Padded.txt" {
+		t.Errorf("padded name listed as %+v", item)
+	}
+	// 无效代理项显示为 U+FFFD，只能以短文件名别名匹配
+	item := byEntry[emoji]
+	if item == nil || item.Name != "Emoji �X Note.txt" {
+		t.Fatalf("unpaired surrogate listed as %+v", item)
+	}
+	if _, _, err := getDirEntry(vol, item.Name); err == nil {
+		t.Error("name with unpaired surrogate matched")
+	}
+	if _, offsets, err := getDirEntry(vol, item.ShortName); err != nil || !reflect.DeepEqual(offsets, emoji.Offsets) {
+		t.Errorf("%s: %v", item.ShortName, err)
+	}
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// PlannedWrite 计划中的一次写入，Sector 与 Offset 定位写入的起始字节
+type PlannedWrite struct {
+	Kind   string // data、fat、fsinfo、dentry
+	Sector uint64
+	Offset uint32 // 扇区内的字节偏移
+	Length uint64
+	Old    []byte `json:",omitempty"` // 元数据写入前的内容，数据区写入时为空
+	New    []byte `json:",omitempty"` // 元数据写入后的内容，数据区写入时为空
+	Detail string
+}
+
+// FilePlan 删除单个文件的写入计划
+type FilePlan struct {
+	Path     string
+	DirEntry FAT32DirEntry
+	Offsets  []*DirEntryOffset
+	Chain    []uint32 // 文件占用的簇，升序排列
+	Writes   []PlannedWrite
+}
+
+// planner 依据与 doRemoveFile 相同的顺序计算写入计划，不修改设备
+// 多个文件共享FSInfo的空闲簇数与提示，因此在计划间累计
+type planner struct {
+	vol       *Volume
+	opts      *RemoveOptions
+	fsInfo    []byte
+	freeCount uint32
+	nextFree  uint32
+}
+
+func newPlanner(vol *Volume, opts *RemoveOptions) (*planner, error) {
+	p := &planner{vol: vol, opts: opts}
+	fsInfo, err := readFSInfo(vol)
+	if err != nil {
+		return nil, err
+	}
+	if fsInfo != nil {
+		p.fsInfo = fsInfo
+		p.freeCount = binary.LittleEndian.Uint32(fsInfo[fsInfoFreeCount:])
+		p.nextFree = binary.LittleEndian.Uint32(fsInfo[fsInfoNextFree:])
+	}
+	return p, nil
+}
+
+// planRemoveFile 计算删除文件时的全部写入：数据簇、每个FAT表副本中的表项、FSInfo与目录项
+func (p *planner) planRemoveFile(path string, dEntry *FAT32DirEntry, dEntryOffsets []*DirEntryOffset) (*FilePlan, error) {
+	chain, err := removeChain(p.vol, p.opts, dEntry)
+	if err != nil {
+		return nil, err
+	}
+	return p.planRemoveChain(path, dEntry, chain, dEntryOffsets)
+}
+
+// planRemoveChain 依据已读取的待释放簇计算删除文件时的全部写入
+func (p *planner) planRemoveChain(path string, dEntry *FAT32DirEntry, chain []uint32, dEntryOffsets []*DirEntryOffset) (*FilePlan, error) {
+	vol := p.vol
+	plan := &FilePlan{Path: path, DirEntry: *dEntry, Offsets: dEntryOffsets, Chain: chain}
+
+	// 数据区按连续簇合并
+	clusterBytes := uint64(vol.BPRSector.BytesPerSector) * uint64(vol.BPRSector.SectorsPerCluster)
+	for i := 0; i < len(plan.Chain); {
+		j := i + 1
+		for j < len(plan.Chain) && plan.Chain[j] == plan.Chain[j-1]+1 {
+			j++
+		}
+		plan.Writes = append(plan.Writes, PlannedWrite{
+			Kind:   "data",
+			Sector: vol.clusterSector(plan.Chain[i]),
+			Length: uint64(j-i) * clusterBytes,
+			Detail: fmt.Sprintf("clusters %d-%d, %s", plan.Chain[i], plan.Chain[j-1], p.opts.Wiper.Profile),
+		})
+		i = j
+	}
+
+	// 每个需要同步的FAT表副本中的表项
+	entriesPerSector := uint32(vol.BPRSector.BytesPerSector) / 4
+	var freed uint32
+	for _, cluster := range plan.Chain {
+		entry, err := readFATEntry(vol, cluster)
+		if err != nil {
+			return nil, err
+		}
+		if entry&0x0fffffff != 0 {
+			freed++
+		}
+		old, cur := make([]byte, 4), make([]byte, 4)
+		binary.LittleEndian.PutUint32(old, entry)
+		binary.LittleEndian.PutUint32(cur, entry&0xf0000000)
+		for _, fat := range vol.fatCopies() {
+			plan.Writes = append(plan.Writes, PlannedWrite{
+				Kind:   "fat",
+				Sector: vol.fatCopySector(fat, cluster/entriesPerSector),
+				Offset: cluster % entriesPerSector * 4,
+				Length: 4,
+				Old:    old,
+				New:    cur,
+				Detail: fmt.Sprintf("FAT%d entry %d", fat+1, cluster),
+			})
+		}
+	}
+
+	// FSInfo 空闲簇数与提示
+	if p.fsInfo != nil && freed > 0 {
+		sectorNum := uint64(vol.BPRSector.FSInfoSector)
+		if p.freeCount != fsInfoUnknown {
+			freeCount := min(p.freeCount+freed, vol.ClusterCount())
+			plan.Writes = append(plan.Writes, p.fsInfoWrite(sectorNum, fsInfoFreeCount, p.freeCount, freeCount, "free count"))
+			p.freeCount = freeCount
+		}
+		if p.nextFree == fsInfoUnknown || plan.Chain[0] < p.nextFree {
+			plan.Writes = append(plan.Writes, p.fsInfoWrite(sectorNum, fsInfoNextFree, p.nextFree, plan.Chain[0], "next free"))
+			p.nextFree = plan.Chain[0]
+		}
+	}
+
+	// 目录项标记为已删除，清除模式下覆写整个目录项
+	fill, err := dEntryFill(vol, p.opts, dEntryOffsets)
+	if err != nil {
+		return nil, err
+	}
+	bytesPerSector := uint32(vol.BPRSector.BytesPerSector)
+	for _, offset := range dEntryOffsets {
+		sectorNum := vol.dEntrySector(offset)
+		buf, err := vol.Driver.ReadSector(sectorNum, 1)
+		if err != nil {
+			return nil, err
+		}
+		start := offset.Offset % bytesPerSector
+		plan.Writes = append(plan.Writes, PlannedWrite{
+			Kind:   "dentry",
+			Sector: sectorNum,
+			Offset: start,
+			Length: uint64(len(fill)),
+			Old:    append([]byte(nil), buf[start:start+uint32(len(fill))]...),
+			New:    fill,
+			Detail: fmt.Sprintf("cluster %d offset %d", offset.ClusterNumber, offset.Offset),
+		})
+	}
+	return plan, nil
+}
+
+func (p *planner) fsInfoWrite(sectorNum uint64, offset uint32, old, cur uint32, name string) PlannedWrite {
+	oldBytes, curBytes := make([]byte, 4), make([]byte, 4)
+	binary.LittleEndian.PutUint32(oldBytes, old)
+	binary.LittleEndian.PutUint32(curBytes, cur)
+	return PlannedWrite{
+		Kind:   "fsinfo",
+		Sector: sectorNum,
+		Offset: offset,
+		Length: 4,
+		Old:    oldBytes,
+		New:    curBytes,
+		Detail: fmt.Sprintf("%s %d -> %d", name, old, cur),
+	}
+}
+
+// planVolumeFlags 计算第一次写入前将卷标记为脏、全部完成后清除脏标记时每个FAT表副本中 FAT[1] 的写入
+// 与 markDirty、markClean 一致，卷原本为脏时两者均不写入
+func (p *planner) planVolumeFlags() (dirty, clean []PlannedWrite, err error) {
+	vol := p.vol
+	flags, err := volumeFlags(vol)
+	if err != nil || flags&fatCleanShutdown == 0 {
+		return nil, nil, err
+	}
+	old, cur := make([]byte, 4), make([]byte, 4)
+	binary.LittleEndian.PutUint32(old, flags)
+	binary.LittleEndian.PutUint32(cur, flags&^fatCleanShutdown)
+	for _, fat := range vol.fatCopies() {
+		write := PlannedWrite{Kind: "fat", Sector: vol.fatCopySector(fat, 0), Offset: 4, Length: 4}
+		write.Old, write.New, write.Detail = old, cur, fmt.Sprintf("FAT%d[1] mark volume dirty", fat+1)
+		dirty = append(dirty, write)
+		write.Old, write.New, write.Detail = cur, old, fmt.Sprintf("FAT%d[1] mark volume clean", fat+1)
+		clean = append(clean, write)
+	}
+	// 卷有硬件错误记录且 --force 时保留脏标记
+	if vol.KeepDirty {
+		clean = nil
+	}
+	return dirty, clean, nil
+}
+
+// printWrite 输出一次计划中的写入
+func printWrite(w io.Writer, write PlannedWrite) {
+	switch write.Kind {
+	case "data":
+		fmt.Fprintf(w, "  %-6s sector %d+%d bytes  %s\n", write.Kind, write.Sector, write.Length, write.Detail)
+	default:
+		fmt.Fprintf(w, "  %-6s sector %d byte %d  %x -> %x  %s\n", write.Kind, write.Sector, write.Offset, write.Old, write.New, write.Detail)
+	}
+}
+
+// printFilePlan 输出文件的写入计划
+func printFilePlan(w io.Writer, plan *FilePlan) {
+	size := plan.DirEntry.FileSize
+	fmt.Fprintf(w, "%s: %d bytes, %d clusters\n", plan.Path, size, len(plan.Chain))
+	for _, write := range plan.Writes {
+		printWrite(w, write)
+	}
+}
+
+// printVolumeWrites 输出卷状态标志的写入，title 说明写入的时机
+func printVolumeWrites(w io.Writer, title string, writes []PlannedWrite) {
+	if len(writes) == 0 {
+		return
+	}
+	fmt.Fprintf(w, "volume: %s\n", title)
+	for _, write := range writes {
+		printWrite(w, write)
+	}
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// saveImage 将内存磁盘写入临时镜像文件
+func saveImage(t testing.TB, driver *MemDriver) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "disk.img")
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	err = file.Truncate(int64(driver.TotalSectors) * int64(driver.BytesPerSector))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, num := range driver.Sectors() {
+		buf, _ := driver.ReadSector(num, 1)
+		_, err = file.WriteAt(buf, int64(num)*int64(driver.BytesPerSector))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return path
+}
+
+func TestPlanMatchesRemoval(t *testing.T) {
+	for _, scrub := range []bool{false, true} {
+		t.Run(fmt.Sprint("scrub=", scrub), func(t *testing.T) {
+			b := NewVolumeBuilder(1024, 2)
+			b.AddFile("docs/Annual Report.txt", fill(5*2048+10, 3))
+			b.AddFileAt("frag.bin", fill(4*2048, 5), 700, 701, 100, 702)
+			b.AddFile("EMPTY.TXT", nil)
+			driver, vol := buildVolume(t, b)
+			wiper, err := NewWiper(WipeProfiles["zero"], nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			opts := &RemoveOptions{Wiper: wiper, ScrubEntries: scrub}
+			plans, err := newPlanner(vol, opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			bps := uint64(vol.BPRSector.BytesPerSector)
+			for _, path := range []string{"docs/Annual Report.txt", "frag.bin", "EMPTY.TXT"} {
+				dEntry, dEntryOffset := lookup(t, vol, path)
+				plan, err := plans.planRemoveFile(path, dEntry, dEntryOffset)
+				if err != nil {
+					t.Fatal(err)
+				}
+				before := driver.Clone()
+				err = doRemoveFile(vol, opts, path, dEntry, dEntryOffset)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				// 实际修改的每个字节都必须在计划之内，计划中的元数据写入必须与实际一致
+				covered := make(map[uint64]bool)
+				for _, write := range plan.Writes {
+					addr := write.Sector*bps + uint64(write.Offset)
+					for i := uint64(0); i < write.Length; i++ {
+						covered[addr+i] = true
+					}
+					if write.Kind == "data" {
+						continue
+					}
+					buf, _ := driver.ReadSector(addr/bps, 1)
+					if got := buf[addr%bps : addr%bps+write.Length]; !bytes.Equal(got, write.New) {
+						t.Errorf("%s: %s %s wrote %x, plan says %x", path, write.Kind, write.Detail, got, write.New)
+					}
+				}
+				for addr := range diffBytes(before, driver) {
+					if !covered[addr] {
+						t.Errorf("%s: byte %#x written but not in plan", path, addr)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestDryRunImage(t *testing.T) {
+	b := NewVolumeBuilder(512, 1)
+	b.AddFileAt("secret.txt", fill(1500, 1), 10, 11, 30)
+	driver, err := b.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := saveImage(t, driver)
+	before, _ := os.ReadFile(path)
+
+	stdout := os.Stdout
+	r, w, _ := os.Pipe()
+	os.Stdout = w
+	wiper, _ := NewWiper(WipeProfiles["zero"], nil)
+	err = RemoveImageFile(path, "/secret.txt", &RemoveOptions{Wiper: wiper, DryRun: true})
+	w.Close()
+	os.Stdout = stdout
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	_, _ = out.ReadFrom(r)
+
+	after, _ := os.ReadFile(path)
+	if !bytes.Equal(before, after) {
+		t.Error("dry-run modified the image")
+	}
+	for _, want := range []string{"clusters 10-11", "clusters 30-30", "FAT1 entry 10", "FAT2 entry 30", "free count", "dentry",
+		"FAT1[1] mark volume dirty", "FAT2[1] mark volume clean"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("plan output missing %q:\n%s", want, out.String())
+		}
+	}
+}
+
+// changeDriver 记录每次写入实际改变的字节地址，之后又被写回原值的字节同样记录
+type changeDriver struct {
+	*MemDriver
+	changed map[uint64]bool
+}
+
+func (d *changeDriver) WriteData(data []byte, sectorNum uint64, offset uint16) error {
+	size := uint64(d.BytesPerSector)
+	start := sectorNum*size + uint64(offset)
+	old, err := d.MemDriver.ReadSector(sectorNum, uint16((uint64(offset)+uint64(len(data))+size-1)/size))
+	if err != nil {
+		return err
+	}
+	for i, c := range data {
+		if old[uint64(offset)+uint64(i)] != c {
+			d.changed[start+uint64(i)] = true
+		}
+	}
+	return d.MemDriver.WriteData(data, sectorNum, offset)
+}
+
+func TestPlanCoversVolumeFlags(t *testing.T) {
+	b := NewVolumeBuilder(512, 1)
+	b.AddFile("docs/a.txt", fill(700, 1))
+	b.AddFile("docs/b.txt", fill(100, 2))
+	mem, vol := buildVolume(t, b)
+	wiper, _ := NewWiper(WipeProfiles["zero"], nil)
+	opts := &RemoveOptions{Wiper: wiper}
+
+	plans, err := newPlanner(vol, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dirty, clean, err := plans.planVolumeFlags()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(dirty) != len(vol.fatCopies()) || len(clean) != len(dirty) {
+		t.Fatalf("planned %d dirty and %d clean writes", len(dirty), len(clean))
+	}
+	writes := append(dirty, clean...)
+	targets, err := collectTargets(vol, "docs", "docs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, target := range targets {
+		plan, err := plans.planRemoveFile(target.Path, target.DirEntry, target.Offsets)
+		if err != nil {
+			t.Fatal(err)
+		}
+		writes = append(writes, plan.Writes...)
+	}
+
+	// 经 removeFromVolume 删除，包括标记与清除脏标记在内的每次修改都必须在计划之内
+	driver := &changeDriver{MemDriver: mem, changed: make(map[uint64]bool)}
+	vol.Driver = driver
+	err = removeFromVolume(vol, opts, "docs", "docs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bps := uint64(vol.BPRSector.BytesPerSector)
+	covered := make(map[uint64]bool)
+	for _, write := range writes {
+		addr := write.Sector*bps + uint64(write.Offset)
+		for i := uint64(0); i < write.Length; i++ {
+			covered[addr+i] = true
+		}
+	}
+	for addr := range driver.changed {
+		if !covered[addr] {
+			t.Errorf("byte %#x written but not in plan", addr)
+		}
+	}
+	for _, fat := range vol.fatCopies() {
+		if addr := vol.fatCopySector(fat, 0)*bps + 7; !driver.changed[addr] {
+			t.Errorf("FAT%d[1] was not marked dirty", fat+1)
+		}
+	}
+}
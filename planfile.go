@@ -0,0 +1,250 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// RemovePlan 序列化的删除计划，由 plan 命令生成，经审核后由 apply 命令执行
+type RemovePlan struct {
+	Image     string `json:",omitempty"` // 镜像文件路径，为空时操作挂载的设备
+	Target    string // 删除目标，挂载设备时为绝对路径，镜像时为卷内路径
+	Wipe      WipeProfile
+	Scrub     bool           `json:",omitempty"` // 覆写整个目录项
+	Salvage   bool           `json:",omitempty"` // 簇链损坏时只覆写可以安全覆写的部分
+	MarkDirty []PlannedWrite `json:",omitempty"` // 第一次写入前将卷标记为脏
+	Files     []*FilePlan
+	MarkClean []PlannedWrite   `json:",omitempty"` // 全部写入同步后清除脏标记
+	Checksums []SectorChecksum // 计划涉及的元数据扇区在生成计划时的校验和
+}
+
+// SectorChecksum 扇区内容的 SHA-256 校验和
+type SectorChecksum struct {
+	Sector uint64
+	SHA256 string
+}
+
+// PlanChangedError 计划生成后元数据扇区发生了变化，拒绝执行
+type PlanChangedError struct {
+	Sectors []uint64
+}
+
+func (e *PlanChangedError) Error() string {
+	nums := make([]string, len(e.Sectors))
+	for i, sectorNum := range e.Sectors {
+		nums[i] = fmt.Sprint(sectorNum)
+	}
+	return "metadata changed since planning, refusing to apply: sectors " + strings.Join(nums, ", ")
+}
+
+// openPlanTarget 打开计划的目标卷，返回驱动器、卷与挂载点前缀
+func openPlanTarget(image, target string, readOnly bool) (Driver, *Volume, string, error) {
+	var driver Driver
+	var prefix string
+	if image != "" {
+		imageDriver := &ImageDriver{ReadOnly: readOnly}
+		err := imageDriver.DInit(image)
+		if err != nil {
+			return nil, nil, "", err
+		}
+		driver = imageDriver
+	} else {
+		defaultDriver, err := getDriveFactory(target, readOnly)
+		if err != nil {
+			return nil, nil, "", err
+		}
+		driver, prefix = defaultDriver, defaultDriver.Prefix
+	}
+	vol, err := NewVolume(driver)
+	if err != nil {
+		return nil, nil, "", err
+	}
+	return driver, vol, prefix, nil
+}
+
+// sectorChecksums 计算计划涉及的元数据扇区与引导扇区的校验和
+// 删除目标为目录时包括目录簇的全部扇区，计划后在目录中新建的文件同样会被发现
+func sectorChecksums(vol *Volume, plan *RemovePlan) ([]SectorChecksum, error) {
+	sectors := map[uint64]bool{0: true}
+	for _, write := range plan.MarkDirty {
+		sectors[write.Sector] = true
+	}
+	spc := uint64(vol.BPRSector.SectorsPerCluster)
+	for _, file := range plan.Files {
+		if file.DirEntry.FileAttributes&0x10 != 0 {
+			for _, cluster := range file.Chain {
+				for i := uint64(0); i < spc; i++ {
+					sectors[vol.clusterSector(cluster)+i] = true
+				}
+			}
+		}
+		for _, write := range file.Writes {
+			if write.Kind != "data" {
+				sectors[write.Sector] = true
+			}
+		}
+	}
+	nums := make([]uint64, 0, len(sectors))
+	for sectorNum := range sectors {
+		nums = append(nums, sectorNum)
+	}
+	sort.Slice(nums, func(i, j int) bool {
+		return nums[i] < nums[j]
+	})
+	checksums := make([]SectorChecksum, len(nums))
+	for i, sectorNum := range nums {
+		buf, err := vol.Driver.ReadSector(sectorNum, 1)
+		if err != nil {
+			return nil, err
+		}
+		sum := sha256.Sum256(buf)
+		checksums[i] = SectorChecksum{Sector: sectorNum, SHA256: hex.EncodeToString(sum[:])}
+	}
+	return checksums, nil
+}
+
+// PlanRemove 以只读方式解析删除目标，将写入计划保存到 output
+func PlanRemove(image, target string, opts *RemoveOptions, output string) error {
+	driver, vol, prefix, err := openPlanTarget(image, target, true)
+	if err != nil {
+		return err
+	}
+	defer driver.DDestroy()
+
+	if opts.CodePage != nil {
+		vol.CodePage = opts.CodePage
+	}
+	path, err := volumePath(image, target, prefix)
+	if err != nil {
+		return err
+	}
+	if path == "" {
+		return errors.New("can not remove volume root")
+	}
+	targets, err := collectTargets(vol, path, target)
+	if err != nil {
+		return err
+	}
+
+	plans, err := newPlanner(vol, opts)
+	if err != nil {
+		return err
+	}
+	plan := &RemovePlan{Image: image, Target: target, Wipe: opts.Wiper.Profile, Scrub: opts.ScrubEntries, Salvage: opts.Salvage}
+	plan.MarkDirty, plan.MarkClean, err = plans.planVolumeFlags()
+	if err != nil {
+		return err
+	}
+	printVolumeWrites(os.Stdout, "before the first write", plan.MarkDirty)
+	for _, file := range targets {
+		filePlan, err := plans.planRemoveFile(file.Path, file.DirEntry, file.Offsets)
+		if err != nil {
+			return err
+		}
+		plan.Files = append(plan.Files, filePlan)
+		printFilePlan(os.Stdout, filePlan)
+	}
+	printVolumeWrites(os.Stdout, "after all writes are synced", plan.MarkClean)
+	plan.Checksums, err = sectorChecksums(vol, plan)
+	if err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(plan, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(output, data, 0o600)
+}
+
+// ApplyPlan 执行删除计划，任何元数据扇区与计划时不一致时拒绝执行
+func ApplyPlan(planPath string, verify, force bool, journalPath string) error {
+	data, err := os.ReadFile(planPath)
+	if err != nil {
+		return err
+	}
+	var plan RemovePlan
+	err = json.Unmarshal(data, &plan)
+	if err != nil {
+		return err
+	}
+
+	driver, vol, _, err := openPlanTarget(plan.Image, plan.Target, false)
+	if err != nil {
+		return err
+	}
+	defer driver.DDestroy()
+
+	err = checkClean(vol, force)
+	if err != nil {
+		return err
+	}
+	checksums, err := sectorChecksums(vol, &plan)
+	if err != nil {
+		return err
+	}
+	planned := make(map[uint64]string, len(plan.Checksums))
+	for _, checksum := range plan.Checksums {
+		planned[checksum.Sector] = checksum.SHA256
+	}
+	var changed []uint64
+	for _, checksum := range checksums {
+		if planned[checksum.Sector] != checksum.SHA256 {
+			changed = append(changed, checksum.Sector)
+		}
+	}
+	if len(changed) > 0 {
+		return &PlanChangedError{Sectors: changed}
+	}
+	// 簇链同样须与计划一致，损坏的簇链按计划时的 --salvage 重新计算
+	for _, file := range plan.Files {
+		chain, err := removeChain(vol, &RemoveOptions{Salvage: plan.Salvage}, &file.DirEntry)
+		if err != nil {
+			return fmt.Errorf("%s: %w", file.Path, err)
+		}
+		if !slices.Equal(chain, file.Chain) {
+			return fmt.Errorf("%s: cluster chain changed since planning, refusing to apply", file.Path)
+		}
+	}
+
+	// 校验通过后才打开预写日志，拒绝执行时不会留下空的日志
+	opts := &RemoveOptions{Verify: verify, Force: force, ScrubEntries: plan.Scrub, JournalPath: journalPath}
+	err = openJournal(opts, plan.Image, plan.Target)
+	if err != nil {
+		return err
+	}
+	opts.Wiper, err = NewWiper(plan.Wipe, nil)
+	if err != nil {
+		return err
+	}
+	if verify {
+		vol.Verifier = NewVerifier()
+	}
+	log.Println("Wipe standard:", plan.Wipe)
+	for _, file := range plan.Files {
+		log.Println("Removing... ", file.Path)
+		dEntry := file.DirEntry
+		err = markDirty(vol)
+		if err != nil {
+			return err
+		}
+		// 使用计划中的簇，--salvage 生成的计划不会因簇链损坏被拒绝
+		err = removeFileChain(vol, opts, file.Path, &dEntry, file.Chain, file.Offsets)
+		if err != nil {
+			return err
+		}
+	}
+	err = markClean(vol)
+	if err != nil {
+		return err
+	}
+	return opts.Journal.Close()
+}
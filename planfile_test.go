@@ -0,0 +1,222 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// planImage 生成镜像中文件的删除计划，返回镜像路径与计划文件路径
+func planImage(t *testing.T) (string, string) {
+	t.Helper()
+	b := NewVolumeBuilder(512, 1)
+	b.AddFileAt("secret.txt", fill(1500, 1), 10, 11, 30)
+	b.AddFile("keep.txt", fill(100, 2))
+	driver, err := b.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	image := saveImage(t, driver)
+	output := filepath.Join(t.TempDir(), "plan.json")
+
+	wiper, _ := NewWiper(WipeProfiles["dod3"], nil)
+	stdout := os.Stdout
+	os.Stdout, _ = os.Open(os.DevNull)
+	err = PlanRemove(image, "secret.txt", &RemoveOptions{Wiper: wiper}, output)
+	os.Stdout = stdout
+	if err != nil {
+		t.Fatal(err)
+	}
+	return image, output
+}
+
+func TestPlanApply(t *testing.T) {
+	image, output := planImage(t)
+	data, err := os.ReadFile(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var plan RemovePlan
+	err = json.Unmarshal(data, &plan)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(plan.Files) != 1 || len(plan.Files[0].Chain) != 3 || plan.Wipe.Name != "dod3" || len(plan.Checksums) == 0 ||
+		len(plan.MarkDirty) != 2 || len(plan.MarkClean) != 2 {
+		t.Fatalf("unexpected plan %+v", plan)
+	}
+
+	err = ApplyPlan(output, true, false, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	driver := &ImageDriver{}
+	err = driver.DInit(image)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer driver.DDestroy()
+	vol, err := NewVolume(driver)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err = getDirEntry(vol, "secret.txt"); err == nil {
+		t.Error("secret.txt still present after apply")
+	}
+	lookup(t, vol, "keep.txt")
+}
+
+func TestApplyRefusesChangedVolume(t *testing.T) {
+	image, output := planImage(t)
+	data, _ := os.ReadFile(output)
+	var plan RemovePlan
+	_ = json.Unmarshal(data, &plan)
+
+	// 计划生成后修改一个目录项扇区
+	var dentry uint64
+	for _, write := range plan.Files[0].Writes {
+		if write.Kind == "dentry" {
+			dentry = write.Sector
+		}
+	}
+	file, err := os.OpenFile(image, os.O_RDWR, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = file.WriteAt([]byte("X"), int64(dentry)*512+500)
+	file.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	before, _ := os.ReadFile(image)
+	journalPath := filepath.Join(t.TempDir(), "journal.jsonl")
+
+	err = ApplyPlan(output, false, false, journalPath)
+	var changed *PlanChangedError
+	if !errors.As(err, &changed) || len(changed.Sectors) != 1 || changed.Sectors[0] != dentry {
+		t.Fatalf("error = %v, want PlanChangedError for sector %d", err, dentry)
+	}
+	after, _ := os.ReadFile(image)
+	if !bytes.Equal(before, after) {
+		t.Error("image modified although plan was refused")
+	}
+	// 拒绝执行时不创建预写日志
+	if _, err = os.Stat(journalPath); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("journal created although plan was refused: %v", err)
+	}
+}
+
+func TestApplySalvagedPlan(t *testing.T) {
+	b := NewVolumeBuilder(512, 1)
+	victim := b.AddFileAt("victim.bin", fill(2000, 1), 10, 11, 12, 13)
+	b.AddFileAt("other.bin", fill(1500, 2), 20, 21, 22)
+	mem, vol := buildVolume(t, b)
+	// victim 的簇链成环，other 交叉链接到13
+	writeFATRaw(t, vol, 13, 11)
+	writeFATRaw(t, vol, 21, 13)
+	image := saveImage(t, mem)
+	output := filepath.Join(t.TempDir(), "plan.json")
+
+	wiper, _ := NewWiper(WipeProfiles["zero"], nil)
+	stdout := os.Stdout
+	os.Stdout, _ = os.Open(os.DevNull)
+	err := PlanRemove(image, victim.Name, &RemoveOptions{Wiper: wiper, Salvage: true}, output)
+	os.Stdout = stdout
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ApplyPlan(output, true, false, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	vol = openImage(t, image)
+	if _, _, err = getDirEntry(vol, victim.Name); err == nil {
+		t.Error("victim.bin still present after apply")
+	}
+	for _, cluster := range []uint32{10, 11, 12} {
+		if entry, _ := readFATEntry(vol, cluster); entry != 0 {
+			t.Errorf("cluster %d not freed: %#x", cluster, entry)
+		}
+	}
+	if entry, _ := readFATEntry(vol, 13); entry != 11 {
+		t.Errorf("shared cluster 13 changed: %#x", entry)
+	}
+	if flags, _ := volumeFlags(vol); flags&fatCleanShutdown == 0 {
+		t.Error("volume left dirty")
+	}
+}
+
+func TestApplyRefusesChangedDirectory(t *testing.T) {
+	b := NewVolumeBuilder(512, 2)
+	docs := b.AddDir("docs")
+	b.AddFile("docs/a.txt", fill(100, 1))
+	mem, err := b.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	image := saveImage(t, mem)
+	output := filepath.Join(t.TempDir(), "plan.json")
+	wiper, _ := NewWiper(WipeProfiles["zero"], nil)
+	stdout := os.Stdout
+	os.Stdout, _ = os.Open(os.DevNull)
+	err = PlanRemove(image, "docs", &RemoveOptions{Wiper: wiper}, output)
+	os.Stdout = stdout
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 计划生成后在目录第二个扇区中新建一个文件，该扇区不在计划的写入中
+	vol := openImage(t, image)
+	sectorNum := vol.clusterSector(docs.Clusters[0]) + 1
+	entry := b.encodeShort([11]byte{'N', 'E', 'W', ' ', ' ', ' ', ' ', ' ', 'T', 'X', 'T'}, 0x20, 0, 0, 0)
+	file, err := os.OpenFile(image, os.O_RDWR, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = file.WriteAt(entry, int64(sectorNum)*512)
+	file.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	before, _ := os.ReadFile(image)
+
+	err = ApplyPlan(output, false, false, "")
+	var changed *PlanChangedError
+	if !errors.As(err, &changed) || len(changed.Sectors) != 1 || changed.Sectors[0] != sectorNum {
+		t.Fatalf("error = %v, want PlanChangedError for sector %d", err, sectorNum)
+	}
+	after, _ := os.ReadFile(image)
+	if !bytes.Equal(before, after) {
+		t.Error("image modified although plan was refused")
+	}
+}
+
+func TestApplyRefusesChangedChain(t *testing.T) {
+	image, output := planImage(t)
+	data, _ := os.ReadFile(output)
+	var plan RemovePlan
+	_ = json.Unmarshal(data, &plan)
+
+	// 手工修改计划中的簇，写入计划与校验和不变
+	plan.Files[0].Chain[2] = 40
+	data, _ = json.Marshal(plan)
+	err := os.WriteFile(output, data, 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	before, _ := os.ReadFile(image)
+
+	err = ApplyPlan(output, false, false, "")
+	if err == nil || !strings.Contains(err.Error(), "cluster chain changed") {
+		t.Fatalf("error = %v, want changed cluster chain", err)
+	}
+	after, _ := os.ReadFile(image)
+	if !bytes.Equal(before, after) {
+		t.Error("image modified although plan was refused")
+	}
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"time"
+)
+
+// DeletedEntry 目录中可恢复的已删除目录项或孤立的长文件名项
+type DeletedEntry struct {
+	Dir       string    // 所在目录，以 / 分隔
+	Name      string    // 由残留的长文件名项或短文件名恢复的文件名
+	ShortName string    // 由长文件名项校验和恢复的完整短文件名
+	Orphan    bool      // 没有对应短文件名项的长文件名项
+	Attr      uint8     // 文件属性
+	Size      uint32    // 文件大小
+	Cluster   uint32    // 起始簇号
+	Modified  time.Time // 最后修改时间，日期无效时为零值
+	Entries   int       // 覆写的32字节目录项数
+}
+
+// scrubDeletedEntries 覆写目录中所有已删除的目录项与孤立的长文件名项，只保留删除标记
+func scrubDeletedEntries(vol *Volume, dirCluster uint32, dirPath string) ([]*DeletedEntry, error) {
+	it, err := newDirIterator(vol, dirCluster)
+	if err != nil {
+		return nil, err
+	}
+	it.deleted = true
+	cur := append([]byte(nil), it.dir...)
+	var found []*DeletedEntry
+	scrub := func(start, count int) {
+		for i := start; i < start+count*32; i += 32 {
+			clear(cur[i+1 : i+32])
+			cur[i] = 0xe5
+		}
+	}
+
+	// 孤立的长文件名项在其后的短文件名项返回之前记录，按目录中的顺序输出
+	orphans := 0
+	for {
+		more := it.Next()
+		for _, run := range it.Malformed[orphans:] {
+			found = append(found, &DeletedEntry{
+				Dir:     dirPath,
+				Name:    displayName(decodeLongName(it.dir[run.pos : run.pos+len(run.Offsets)*32])),
+				Orphan:  true,
+				Entries: len(run.Offsets),
+			})
+			scrub(run.pos, len(run.Offsets))
+		}
+		orphans = len(it.Malformed)
+		if !more {
+			break
+		}
+		item := it.Item()
+		if !item.isDeleted() {
+			continue
+		}
+		entry := &DeletedEntry{
+			Dir:      dirPath,
+			Name:     item.Name,
+			Attr:     item.Entry.FileAttributes,
+			Size:     item.Entry.FileSize,
+			Cluster:  item.cluster(),
+			Modified: item.Modified(),
+			Entries:  len(item.Offsets),
+		}
+		// 只有由长文件名项恢复了首字节时短文件名才完整
+		if len(item.Offsets) > 1 {
+			entry.ShortName = item.ShortName
+		}
+		found = append(found, entry)
+		scrub(item.pos, len(item.Offsets))
+	}
+	if it.Err() != nil {
+		return nil, it.Err()
+	}
+
+	err = writeDir(vol, it.chain, it.dir, cur)
+	if err != nil {
+		return nil, err
+	}
+	return found, nil
+}
+
+// ScrubDeletedEntries 遍历卷上所有目录，覆写已删除的目录项与孤立的长文件名项，并输出被覆写的内容
+func ScrubDeletedEntries(image, target string, opts *RemoveOptions, report io.Writer) error {
+	driver, vol, _, err := openPlanTarget(image, target, false)
+	if err != nil {
+		return err
+	}
+	defer driver.DDestroy()
+
+	if opts.CodePage != nil {
+		vol.CodePage = opts.CodePage
+	}
+	if opts.Verify {
+		vol.Verifier = NewVerifier()
+	}
+	err = checkClean(vol, opts.Force)
+	if err != nil {
+		return err
+	}
+	err = markDirty(vol)
+	if err != nil {
+		return err
+	}
+
+	var found []*DeletedEntry
+	scrubDir := func(dirCluster uint32, dirPath string) error {
+		entries, err := scrubDeletedEntries(vol, dirCluster, dirPath)
+		found = append(found, entries...)
+		return err
+	}
+	err = scrubDir(vol.BPRSector.RootCluster, "")
+	if err != nil {
+		return err
+	}
+	dirs := 1
+	err = walkTree(vol, vol.BPRSector.RootCluster, "", func(path string, item *DirItem) error {
+		if item.Entry.FileAttributes&0x10 == 0 || item.cluster() == 0 {
+			return nil
+		}
+		dirs++
+		return scrubDir(item.cluster(), path)
+	})
+	if err != nil {
+		return err
+	}
+	err = markClean(vol)
+	if err != nil {
+		return err
+	}
+	if vol.Verifier != nil {
+		err = vol.Verifier.Check(vol.Driver)
+		if err != nil {
+			return err
+		}
+	}
+
+	entries := 0
+	for _, item := range found {
+		entries += item.Entries
+		dir := item.Dir + "/"
+		if item.Orphan {
+			fmt.Fprintf(report, "orphan LFN  %s%s  (%d entries)\n", dir, item.Name, item.Entries)
+			continue
+		}
+		modified := "-"
+		if !item.Modified.IsZero() {
+			modified = item.Modified.Format("2006-01-02 15:04:05")
+		}
+		name := item.Name
+		if item.ShortName != "" {
+			name += " (" + item.ShortName + ")"
+		}
+		fmt.Fprintf(report, "deleted     %s%s  %d bytes  cluster %d  modified %s\n", dir, name, item.Size, item.Cluster, modified)
+	}
+	log.Printf("Scrubbed %d deleted or orphaned names, %d entries in %d directories", len(found), entries, dirs)
+	return nil
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestScrubDeletedEntries(t *testing.T) {
+	b := NewVolumeBuilder(512, 1)
+	secret := b.AddFile("docs/Secret Plan.docx", fill(3000, 1))
+	old := b.AddFile("docs/OLDFILE.TXT", fill(100, 2))
+	renamed := b.AddFile("docs/Holiday Photo.jpeg", fill(800, 3))
+	b.AddFile("top.txt", fill(10, 4))
+	driver, vol := buildVolume(t, b)
+	removePath(t, vol, "docs/Secret Plan.docx")
+	removePath(t, vol, "docs/OLDFILE.TXT")
+	// 破坏长文件名项的校验和，使其成为孤立项
+	for _, offset := range renamed.Offsets[:len(renamed.Offsets)-1] {
+		sector, _ := driver.ReadSector(vol.dEntrySector(offset), 1)
+		sector[offset.Offset%512+13]++
+		_ = driver.WriteData(sector, vol.dEntrySector(offset), 0)
+	}
+	path := saveImage(t, driver)
+
+	var report bytes.Buffer
+	err := ScrubDeletedEntries(path, "", &RemoveOptions{}, &report)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		fmt.Sprintf("deleted     /docs/Secret Plan.docx (SECRET~1.DOC)  3000 bytes  cluster %d  modified 2024-01-01 12:00:00", secret.Clusters[0]),
+		"deleted     /docs/?LDFILE.TXT  100 bytes",
+		"orphan LFN  /docs/Holiday Photo.jpeg  (2 entries)",
+	} {
+		if !strings.Contains(report.String(), want) {
+			t.Errorf("report missing %q:\n%s", want, report.String())
+		}
+	}
+	if n := strings.Count(report.String(), "\n"); n != 3 {
+		t.Errorf("report has %d lines, want 3:\n%s", n, report.String())
+	}
+
+	vol = openImage(t, path)
+	for _, entry := range []*BuildEntry{secret, old, renamed} {
+		offsets := entry.Offsets
+		if entry == renamed {
+			offsets = offsets[:len(offsets)-1]
+		}
+		for _, offset := range offsets {
+			sector, _ := vol.Driver.ReadSector(vol.dEntrySector(offset), 1)
+			if e := sector[offset.Offset%512:][:32]; !scrubbed(e) {
+				t.Errorf("%s: entry at %d not scrubbed: %x", entry.Name, offset.Offset, e)
+			}
+		}
+	}
+	// 长文件名被清除后文件仍可通过短文件名访问
+	lookup(t, vol, "docs/HOLIDA~1.JPE")
+	lookup(t, vol, "top.txt")
+
+	// 再次执行没有可清除的内容
+	report.Reset()
+	err = ScrubDeletedEntries(path, "", &RemoveOptions{}, &report)
+	if err != nil || report.Len() != 0 {
+		t.Errorf("second run: %v\n%s", err, report.String())
+	}
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+)
+
+// SlackResult 文件尾部空间覆写的统计
+type SlackResult struct {
+	Files int    // 处理的文件数
+	Dirs  int    // 处理的目录数
+	Bytes uint64 // 覆写的文件尾部字节数与清零的目录残留字节数
+}
+
+// wipeFileSlack 覆写文件最后一个簇中文件末尾之后的字节，不改变文件内容
+// 簇链长度以文件大小为上限，超出时可能与其他文件交叉链接，返回 ChainError 而不覆写
+func wipeFileSlack(vol *Volume, opts *RemoveOptions, item *DirItem) (uint64, error) {
+	if item.cluster() == 0 {
+		return 0, nil
+	}
+	chain, err := followChain(vol, item.cluster(), max(clustersFor(vol, item.Entry.FileSize), 1))
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", item.Name, err)
+	}
+	bytesPerSector := uint64(vol.BPRSector.BytesPerSector)
+	spc := uint64(vol.BPRSector.SectorsPerCluster)
+	clusterBytes := bytesPerSector * spc
+	size := uint64(item.Entry.FileSize)
+	need := (size + clusterBytes - 1) / clusterBytes
+	if need > uint64(len(chain)) {
+		return 0, fmt.Errorf("%s: %d bytes but only %d clusters allocated", item.Name, size, len(chain))
+	}
+
+	var wiped uint64
+	if used := size % clusterBytes; used != 0 {
+		first := vol.clusterSector(chain[need-1])
+		sectorNum := first + used/bytesPerSector
+		// 文件末尾所在的扇区保留文件内容，只覆写其后的字节
+		if keep := used % bytesPerSector; keep != 0 {
+			err = opts.Wiper.wipeSectorTail(vol, sectorNum, int(keep), opts.Verify)
+			if err != nil {
+				return 0, err
+			}
+			wiped += bytesPerSector - keep
+			sectorNum++
+		}
+		var sectors []uint64
+		for ; sectorNum < first+spc; sectorNum++ {
+			sectors = append(sectors, sectorNum)
+		}
+		err = opts.Wiper.wipeSectors(vol, sectors, opts.Verify)
+		if err != nil {
+			return 0, err
+		}
+		wiped += uint64(len(sectors)) * bytesPerSector
+	}
+	return wiped, nil
+}
+
+// wipeDirSlack 将目录结束标志0x00所在的目录项及其后直到簇链末尾的空间清零
+// 结束标志之后的残留目录项不再被解析，同样清除；目录项首字节为0表示目录结束，因此无论覆写标准如何都只能写入0
+// 返回被改写的扇区中自结束标志起的字节数
+func wipeDirSlack(vol *Volume, dirCluster uint32) (uint64, error) {
+	it, err := newDirIterator(vol, dirCluster)
+	if err != nil {
+		return 0, err
+	}
+	for it.Next() {
+	}
+	if it.Err() != nil {
+		return 0, it.Err()
+	}
+	dir, start := it.dir, it.end
+
+	cur := append([]byte(nil), dir...)
+	clear(cur[start:])
+	bytesPerSector := int(vol.BPRSector.BytesPerSector)
+	var wiped uint64
+	for i := start - start%bytesPerSector; i < len(dir); i += bytesPerSector {
+		from := max(start, i)
+		if !bytes.Equal(dir[from:i+bytesPerSector], cur[from:i+bytesPerSector]) {
+			wiped += uint64(i + bytesPerSector - from)
+		}
+	}
+	err = writeDir(vol, it.chain, dir, cur)
+	if err != nil {
+		return 0, err
+	}
+	return wiped, nil
+}
+
+// wipeSlack 覆写文件或目录树中所有文件的尾部空间，以及每个目录末尾的未使用空间
+func wipeSlack(vol *Volume, opts *RemoveOptions, path string, item *DirItem) (*SlackResult, error) {
+	result := &SlackResult{}
+	if item.Entry.FileAttributes&0x10 == 0 {
+		wiped, err := wipeFileSlack(vol, opts, item)
+		if err != nil {
+			return nil, err
+		}
+		result.Files++
+		result.Bytes += wiped
+		return result, nil
+	}
+
+	wipeDir := func(dirCluster uint32) error {
+		wiped, err := wipeDirSlack(vol, dirCluster)
+		if err != nil {
+			return err
+		}
+		result.Dirs++
+		result.Bytes += wiped
+		return nil
+	}
+	err := wipeDir(item.cluster())
+	if err != nil {
+		return nil, err
+	}
+	err = walkTree(vol, item.cluster(), path, func(path string, item *DirItem) error {
+		if item.Entry.FileAttributes&0x10 != 0 {
+			return wipeDir(item.cluster())
+		}
+		wiped, err := wipeFileSlack(vol, opts, item)
+		if err != nil {
+			return err
+		}
+		result.Files++
+		result.Bytes += wiped
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// WipeSlack 覆写文件、目录树或整个卷的尾部空间，target 为空或卷根目录时处理整个卷
+func WipeSlack(image, target string, opts *RemoveOptions) error {
+	driver, vol, prefix, err := openPlanTarget(image, target, false)
+	if err != nil {
+		return err
+	}
+	defer driver.DDestroy()
+
+	if opts.CodePage != nil {
+		vol.CodePage = opts.CodePage
+	}
+	path, err := volumePath(image, target, prefix)
+	if err != nil {
+		return err
+	}
+	root := vol.BPRSector.RootCluster
+	item := &DirItem{Name: "/", Entry: FAT32DirEntry{
+		FileAttributes: 0x10,
+		ClusterHigh:    uint16(root >> 16),
+		ClusterLow:     uint16(root),
+	}}
+	if path != "" {
+		dEntry, _, err := getDirEntry(vol, path)
+		if err != nil {
+			return err
+		}
+		item = &DirItem{Name: path, Entry: *dEntry}
+	}
+	if opts.Verify {
+		vol.Verifier = NewVerifier()
+	}
+	err = checkClean(vol, opts.Force)
+	if err != nil {
+		return err
+	}
+	err = markDirty(vol)
+	if err != nil {
+		return err
+	}
+
+	log.Println("Wipe standard:", opts.Wiper.Profile)
+	result, err := wipeSlack(vol, opts, "", item)
+	if err != nil {
+		return err
+	}
+	err = markClean(vol)
+	if err != nil {
+		return err
+	}
+	if vol.Verifier != nil {
+		err = vol.Verifier.Check(vol.Driver)
+		if err != nil {
+			return err
+		}
+	}
+	log.Printf("Wiped slack of %d files and %d directories, %d bytes", result.Files, result.Dirs, result.Bytes)
+	log.Println("Wiped", opts.Wiper.Stats)
+	return nil
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestWipeSlack(t *testing.T) {
+	b := NewVolumeBuilder(512, 2)
+	docs := b.AddDir("docs")
+	inside := b.AddFile("docs/Draft Letter.txt", fill(1500, 1))
+	b.AddFile("docs/sub/exact.bin", fill(2048, 2))
+	outside := b.AddFile("keep.txt", fill(700, 3))
+	driver, vol := buildVolume(t, b)
+
+	// 在文件尾部空间与目录末尾写入残留数据
+	junk := bytes.Repeat([]byte{0xaa}, 1024)
+	for _, entry := range []*BuildEntry{inside, outside} {
+		last := entry.Clusters[len(entry.Clusters)-1]
+		buf := readCluster(t, vol, last)
+		used := len(entry.Content) % 1024
+		copy(buf[used:], junk)
+		_ = driver.WriteData(buf, vol.clusterSector(last), 0)
+	}
+	dirBuf := readCluster(t, vol, docs.Clusters[0])
+	tail := len(dirBuf) - 64
+	copy(dirBuf[tail+1:tail+32], junk)
+	copy(dirBuf[tail+33:], junk)
+	// 结束标志之后残留的目录项首字节不为0，同样属于目录末尾
+	dirBuf[tail+32] = 'X'
+	_ = driver.WriteData(dirBuf, vol.clusterSector(docs.Clusters[0]), 0)
+
+	wiper, _ := NewWiper(WipeProfiles["one"], nil)
+	dEntry, _ := lookup(t, vol, "docs")
+	result, err := wipeSlack(vol, &RemoveOptions{Wiper: wiper}, "docs", &DirItem{Name: "docs", Entry: *dEntry})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Files != 2 || result.Dirs != 2 {
+		t.Errorf("processed %d files %d dirs, want 2 and 2", result.Files, result.Dirs)
+	}
+	if want := uint64(1024-1500%1024) + 512; result.Bytes != want {
+		t.Errorf("wiped %d bytes, want %d", result.Bytes, want)
+	}
+
+	// 文件内容不变，尾部空间按覆写标准填充
+	buf := append(readCluster(t, vol, inside.Clusters[0]), readCluster(t, vol, inside.Clusters[1])...)
+	if !bytes.Equal(buf[:1500], inside.Content) {
+		t.Error("file content changed")
+	}
+	if !bytes.Equal(buf[1500:], bytes.Repeat([]byte{0xff}, 2048-1500)) {
+		t.Error("file slack not wiped")
+	}
+	// 目录末尾清零，目录项仍可查找
+	dirBuf = readCluster(t, vol, docs.Clusters[0])
+	if !bytes.Equal(dirBuf[tail:], make([]byte, 64)) {
+		t.Error("directory slack not cleared")
+	}
+	lookup(t, vol, "docs/sub/exact.bin")
+	// 目录树以外的文件不受影响
+	buf = readCluster(t, vol, outside.Clusters[0])
+	if !bytes.Equal(buf[700:], junk[:1024-700]) {
+		t.Error("file outside the subtree was wiped")
+	}
+}
+
+func TestWipeSlackCrossLinked(t *testing.T) {
+	b := NewVolumeBuilder(512, 1)
+	a := b.AddFileAt("a.bin", fill(100, 1), 30)
+	other := b.AddFileAt("b.bin", fill(512, 2), 40)
+	_, vol := buildVolume(t, b)
+	// a.bin 只有一个簇的大小，簇链却链接到 b.bin 的簇
+	writeFATRaw(t, vol, 30, 40)
+
+	wiper, _ := NewWiper(WipeProfiles["zero"], nil)
+	dEntry, _ := lookup(t, vol, a.Name)
+	_, err := wipeSlack(vol, &RemoveOptions{Wiper: wiper}, a.Name, &DirItem{Name: a.Name, Entry: *dEntry})
+	var chainErr *ChainError
+	if !errors.As(err, &chainErr) || chainErr.Reason != chainTooLong {
+		t.Fatalf("got %v, want %s", err, chainTooLong)
+	}
+	if !bytes.Equal(readCluster(t, vol, 40), other.Content) {
+		t.Error("b.bin wiped through a cross-linked chain")
+	}
+	if !bytes.Equal(readCluster(t, vol, 30)[:100], a.Content) {
+		t.Error("a.bin content changed")
+	}
+}
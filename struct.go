@@ -29,14 +29,14 @@ type FAT32BootSector struct {
 	VolumeSerialNumber    uint32    // 0x43~0x46：卷序列号
 	VolumeLabel           [11]byte  // 0x47~0x51：卷标（ASCII）
 	FileSystemType        [8]byte   // 0x52~0x59：文件系统格式（ASCII），如FAT32
-	Unused2               [410]byte // 0x5A~0x1FD：未使用
+	Unused2               [420]byte // 0x5A~0x1FD：未使用
 	Signature             uint16    // 0x1FE~0x1FF：签名标志“55 AA”
 }
 
 type FAT32DirEntry struct {
 	FileName         [11]byte // 0x00~0x0A：文件名（ASCII）
 	FileAttributes   uint8    // 0x0B：文件属性
-	Reserved         uint8    // 0x0C：保留
+	CaseFlags        uint8    // 0x0C：Windows NT 大小写标志，0x08主文件名小写，0x10拓展名小写
 	CreateTimeFine   uint8    // 0x0D：建立时间（精确到0.01秒）
 	CreateTime       uint16   // 0x0E~0x0F：建立时间
 	CreateDate       uint16   // 0x10~0x11：建立日期
@@ -64,21 +64,38 @@ type FAT32Offset struct {
 	Data   uint32 // 数据区
 }
 
-type FAT32Buffer struct {
-	// 存储32扇区的fat32表，占用内存 32 * 512 = 16k
-	Number uint32
-	Link   []uint32
-}
-
 type DirEntryOffset struct {
 	ClusterNumber uint32
-	Offset        uint16
+	Offset        uint32 // 目录项在簇内的字节偏移，簇最大可达 128 * 4096 字节
 }
 
-// Driver 抽象驱动器结构，linux与win分别实现
+// Driver 抽象驱动器结构，linux、win与镜像文件分别实现
 type Driver interface {
 	DInit(absFileName string) error
 	ReadSector(sectorNum uint64, readNum uint16) (buffer []byte, err error)
 	WriteData(data []byte, sectorNum uint64, offset uint16) error
 	DDestroy() error
 }
+
+// Syncer 可将已写入的数据同步到设备的驱动器
+type Syncer interface {
+	Sync() error
+}
+
+// DirectReader 可绕过页缓存读取扇区的驱动器，用于回读校验
+type DirectReader interface {
+	ReadSectorDirect(sectorNum uint64, readNum uint16) ([]byte, error)
+}
+
+// RemoveOptions 删除操作的选项
+type RemoveOptions struct {
+	Wiper        *Wiper    // 文件内容的覆写方式
+	Verify       bool      // 回读校验所有覆写的簇与修改的元数据扇区
+	DryRun       bool      // 只读打开设备，仅输出写入计划
+	Force        bool      // 卷已被标记为脏时仍然执行
+	ScrubEntries bool      // 覆写整个目录项与长文件名项，而不仅是首字节
+	JournalPath  string    // 预写日志路径，为空时不记录日志
+	Journal      *Journal  // 打开的预写日志
+	CodePage     *CodePage // 短文件名使用的代码页，为空时使用默认代码页
+	Salvage      bool      // 簇链损坏时只覆写可以安全覆写的部分，而不是放弃删除
+}
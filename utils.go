@@ -4,331 +4,265 @@ import (
 	"bytes"
 	"encoding/binary"
 	"errors"
+	"fmt"
 	"log"
 	"os"
 	"path/filepath"
-	"sort"
 	"strings"
-	"unicode/utf16"
+	"unicode/utf8"
 )
 
-var FATBuffer *FAT32Buffer
-
-const FAT32BufferSize = 32
-
-// fileNameEqual 短文件名目录项比较
-func fileNameEqual(dEntryName []byte, fileName string) (bool, error) {
-	fileExt := filepath.Ext(fileName)
-	fileBase := strings.TrimSuffix(fileName, fileExt)
-	dEntryFileBase := strings.Replace(string(dEntryName[:8]), " ", "", -1)
-	dEntryFileExt := strings.Replace(string(dEntryName[8:]), " ", "", -1)
-	// 删除拓展名的点
-	if dEntryFileBase == strings.ToUpper(fileBase) &&
-		dEntryFileExt == strings.ToUpper(fileExt[1:]) {
-		return true, nil
-	} else {
-		return false, nil
-	}
-}
-
-// listFiles 返回一个目录下所有的子目录与文件，如有子目录会同时进入列出
-func listFiles(root string) ([]string, error) {
-	var files []string
-	// 使用 Walk 函数递归遍历目录和文件
-	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			return err
-		}
-		// 只添加文件和目录的绝对路径
-		if path != root { // 排除根目录
-			absPath, err := filepath.Abs(path)
-			if err != nil {
-				return err
-			}
-			files = append(files, absPath)
-		}
-		return nil
-	})
-	if err != nil {
-		return nil, err
+// getDirEntry 依据路径获取最后一个目录项与目录项对应的偏移
+func getDirEntry(vol *Volume, filePath string) (*FAT32DirEntry, []*DirEntryOffset, error) {
+	filePathArr := splitVolumePath(filePath)
+	if len(filePathArr) == 0 {
+		return nil, nil, errors.New("path refers to the volume root")
 	}
-
-	// 将根目录添加到最后
-	rootAbs, err := filepath.Abs(root)
-	if err != nil {
-		return nil, err
+	dEntry := &FAT32DirEntry{
+		ClusterHigh: uint16(vol.BPRSector.RootCluster >> 16),
+		ClusterLow:  uint16(vol.BPRSector.RootCluster),
 	}
-	files = append(files, rootAbs)
-
-	return files, nil
-}
-
-// getDirEntry 依据路径获取最后一个目录项与目录项对应的偏移
-func getDirEntry(driver *DefaultDriver, filePath string) (*FAT32DirEntry, []*DirEntryOffset, error) {
-	filePathArr := strings.Split(filePath, Segment)
-	dEntry := &FAT32DirEntry{ClusterLow: 2}
 	var dEntryOffset []*DirEntryOffset
 
-	for _, name := range filePathArr {
-		dEntryLL, err := getFATLink(driver, (uint32(dEntry.ClusterHigh)<<16)+uint32(dEntry.ClusterLow))
-		if err != nil {
-			return nil, nil, err
+	for i, name := range filePathArr {
+		if i > 0 && dEntry.FileAttributes&0x10 == 0 {
+			return nil, nil, fmt.Errorf("%s: not a directory", strings.Join(filePathArr[:i], "/"))
 		}
-		dEntry, dEntryOffset, err = findDirEntry(driver, dEntryLL, name)
+		var err error
+		dEntry, dEntryOffset, err = findDirEntry(vol, uint32(dEntry.ClusterHigh)<<16|uint32(dEntry.ClusterLow), name)
 		if err != nil {
 			return nil, nil, err
 		}
-
 	}
 	return dEntry, dEntryOffset, nil
 }
 
-// findDirEntry 依据文件名搜索目录项
-func findDirEntry(driver *DefaultDriver, dEntryLL []uint32, targetFile string) (*FAT32DirEntry, []*DirEntryOffset, error) {
-	const dEntryChunkSize = 32
-
-	for _, cluster := range dEntryLL {
-		// 结束
-		if cluster >= 0x0ffffff8 {
-			break
+// findDirEntry 依据文件名在目录中搜索目录项，长文件名与短文件名别名均可匹配，删除时长文件名项一并删除
+// 与磁盘上的文件名完全相同的项优先；否则忽略大小写与 Unicode 规范化形式的差异，匹配多项时返回错误
+func findDirEntry(vol *Volume, dirCluster uint32, targetFile string) (*FAT32DirEntry, []*DirEntryOffset, error) {
+	it, err := newDirIterator(vol, dirCluster)
+	if err != nil {
+		return nil, nil, err
+	}
+	var found []*DirItem
+	for it.Next() {
+		item := it.Item()
+		if item.isLabel() {
+			continue
 		}
-		// 依据簇号链表获取完整目录项
-		buffer, err := driver.ReadSector(
-			uint64(driver.Offset.Data)+uint64(cluster-2)*uint64(driver.BPRSector.SectorsPerCluster),
-			uint16(driver.BPRSector.SectorsPerCluster),
-		)
-		if err != nil {
-			return nil, nil, err
+		if !strings.ContainsRune(targetFile, utf8.RuneError) && (item.LongName == targetFile || item.ShortName == targetFile) {
+			return &item.Entry, item.Offsets, nil
 		}
-
-		var dEntry FAT32DirEntry
-		var dEntryName []uint16
-		var dEntryOffset []*DirEntryOffset
-
-		// 匹配每个目录项
-		for i := 0; i < len(buffer); i += dEntryChunkSize {
-			if i+dEntryChunkSize > len(buffer) {
-				break
-			}
-			chunk := buffer[i : i+dEntryChunkSize]
-
-			if chunk[0] == 0 || chunk[0] == 229 {
-				// 跳过未使用的目录项与已删除项
-				continue
-			}
-
-			switch chunk[11] {
-			case 16, 32: // 短文件名目录项
-				err = binary.Read(bytes.NewReader(chunk), binary.LittleEndian, &dEntry)
-				if err != nil {
-					return nil, nil, err
-				}
-				// 长文件名
-				if dEntryName != nil {
-					// 截取到为0的元素
-					for j := 0; j < len(dEntryName); j++ {
-						if dEntryName[j] == 0 {
-							dEntryName = dEntryName[:j]
-							break
-						}
-					}
-					if string(utf16.Decode(dEntryName)) == targetFile {
-						dEntryOffset = append(dEntryOffset, &DirEntryOffset{
-							cluster,
-							uint16(i),
-						})
-						return &dEntry, dEntryOffset, nil
-					}
-					dEntryName = nil
-					dEntryOffset = []*DirEntryOffset{}
-					// 长文件名不一致，证明不是该目录项，无需比较短文件名目录项
-					continue
-				}
-
-				isEqual, err := fileNameEqual(dEntry.FileName[:11], targetFile)
-				if err != nil {
-					return nil, nil, err
-				}
-				if isEqual {
-					dEntryOffset = []*DirEntryOffset{
-						{
-							cluster,
-							uint16(i),
-						},
-					}
-					return &dEntry, dEntryOffset, nil
-				}
-			case 15: // 解析长文件名项
-				var lDEntry FAT32LongDirEntry
-				err = binary.Read(bytes.NewReader(chunk), binary.LittleEndian, &lDEntry)
-				if err != nil {
-					return nil, nil, err
-				}
-				// 长文件名结束
-				if lDEntry.SequenceNumber&0x40 == 0x40 {
-					// 依据长度创建文件名切片
-					dEntryName = make([]uint16, (lDEntry.SequenceNumber&0x1f)*13)
-				}
-				// 将长文件名项写入文件名切片
-				tmpName := append(lDEntry.Name1[:5], lDEntry.Name2[:6]...)
-				tmpName = append(tmpName, lDEntry.Name3[:2]...)
-				copy(dEntryName[13*((lDEntry.SequenceNumber&0x1f)-1):], tmpName)
-				// 将长文件名偏移写入
-				dEntryOffset = append(dEntryOffset, &DirEntryOffset{
-					cluster,
-					uint16(i),
-				})
-			}
-
+		if longNameEqual(item.LongName, targetFile) || vol.CodePage.fileNameEqual(item.Entry.FileName, targetFile) {
+			found = append(found, item)
 		}
 	}
-	return nil, nil, errors.New("not found")
+	if it.Err() != nil {
+		return nil, nil, it.Err()
+	}
+	logMalformed(it)
+	switch len(found) {
+	case 0:
+		return nil, nil, errors.New("not found")
+	case 1:
+		return &found[0].Entry, found[0].Offsets, nil
+	}
+	// NFC 与 NFD 形式的同名文件可以同时存在，不能任选其一
+	names := make([]string, len(found))
+	for i, item := range found {
+		names[i] = fmt.Sprintf("%q (%s)", item.LongName, item.ShortName)
+	}
+	return nil, nil, fmt.Errorf("%s is ambiguous, matches %s; use the short name", targetFile, strings.Join(names, ", "))
 }
 
-func doRemoveFile(driver *DefaultDriver, dEntry *FAT32DirEntry, dEntryOffsets []*DirEntryOffset) error {
-	if dEntry.ClusterHigh == 0 && dEntry.ClusterLow == 0 { // 空文件
-		err := rmDEntry(driver, dEntryOffsets)
-		if err != nil {
-			return err
-		}
-	} else {
-		fat32LL, err := getFATLink(driver, (uint32(dEntry.ClusterHigh)<<16)+uint32(dEntry.ClusterLow))
-		sort.Slice(fat32LL, func(i, j int) bool {
-			return fat32LL[i] < fat32LL[j]
-		})
+// doRemoveFile 删除文件，path 为日志中记录的显示路径
+func doRemoveFile(vol *Volume, opts *RemoveOptions, path string, dEntry *FAT32DirEntry, dEntryOffsets []*DirEntryOffset) error {
+	fat32LL, err := removeChain(vol, opts, dEntry)
+	if err != nil {
+		return err
+	}
+	return removeFileChain(vol, opts, path, dEntry, fat32LL, dEntryOffsets)
+}
+
+// removeFileChain 覆写并释放已确定的簇，再删除目录项；apply 直接使用审核过的计划中的簇
+func removeFileChain(vol *Volume, opts *RemoveOptions, path string, dEntry *FAT32DirEntry, fat32LL []uint32, dEntryOffsets []*DirEntryOffset) error {
+	// 写入设备前先在日志中记录预期的修改，之后每个阶段同步到设备再记录进度
+	err := opts.Journal.Begin(vol, opts, path, dEntry, fat32LL, dEntryOffsets)
+	if err != nil {
+		return err
+	}
+	if len(fat32LL) > 0 { // 非空文件
+		err = cleanFileContent(vol, opts, fat32LL)
 		if err != nil {
 			return err
 		}
-		err = cleanFileContent(driver, fat32LL)
+		err = opts.Journal.Phase(vol, journalWiped)
 		if err != nil {
 			return err
 		}
-		err = rmFAT32Link(driver, fat32LL)
+		err = rmFAT32Link(vol, fat32LL)
 		if err != nil {
 			return err
 		}
-		err = rmDEntry(driver, dEntryOffsets)
+		err = opts.Journal.Phase(vol, journalFreed)
 		if err != nil {
 			return err
 		}
 	}
+	fill, err := dEntryFill(vol, opts, dEntryOffsets)
+	if err != nil {
+		return err
+	}
+	err = rmDEntry(vol, fill, dEntryOffsets)
+	if err != nil {
+		return err
+	}
+	err = opts.Journal.Phase(vol, journalCommit)
+	if err != nil {
+		return err
+	}
+	// 回读校验本次修改的目录项、FAT表与FSInfo扇区
+	if vol.Verifier != nil {
+		return vol.Verifier.Check(vol.Driver)
+	}
 	return nil
 }
 
-// rmDEntry 将目录项标记为已删除
-func rmDEntry(driver *DefaultDriver, dEntryOffset []*DirEntryOffset) error {
-	sectorNum := (dEntryOffset[0].ClusterNumber-2)*uint32(driver.BPRSector.SectorsPerCluster) + driver.Offset.Data
-	buf, err := driver.ReadSector(uint64(sectorNum), 1)
+// dEntryFill 返回删除目录项时写入每个32字节目录项起始处的内容
+// 默认仅将首字节标记为0xE5；清除模式下覆写整个目录项，只保留删除标记，
+// 若目录项位于目录末尾，则全部清零，使其成为目录结束标记
+func dEntryFill(vol *Volume, opts *RemoveOptions, dEntryOffsets []*DirEntryOffset) ([]byte, error) {
+	if !opts.ScrubEntries {
+		return []byte{0xe5}, nil
+	}
+	fill := make([]byte, 32)
+	tail, err := dirTail(vol, dEntryOffsets[len(dEntryOffsets)-1])
 	if err != nil {
-		return err
+		return nil, err
 	}
-	for _, offset := range dEntryOffset {
-		if sectorNum != (offset.ClusterNumber-2)*uint32(driver.BPRSector.SectorsPerCluster)+driver.Offset.Data {
-			err = driver.WriteData(buf, uint64(sectorNum), 0)
-			if err != nil {
-				return err
-			}
-			sectorNum = (dEntryOffset[0].ClusterNumber-2)*uint32(driver.BPRSector.SectorsPerCluster) + driver.Offset.Data
-			buf, err = driver.ReadSector(uint64(sectorNum), 1)
-			if err != nil {
-				return err
-			}
+	if !tail {
+		fill[0] = 0xe5
+	}
+	return fill, nil
+}
+
+// dirTail 判断目录项之后是否再无目录项，即下一项为目录结束标记或已到目录簇链末尾
+func dirTail(vol *Volume, offset *DirEntryOffset) (bool, error) {
+	bytesPerSector := uint32(vol.BPRSector.BytesPerSector)
+	clusterBytes := bytesPerSector * uint32(vol.BPRSector.SectorsPerCluster)
+	next := &DirEntryOffset{ClusterNumber: offset.ClusterNumber, Offset: offset.Offset + 32}
+	if next.Offset >= clusterBytes {
+		cluster, err := readFATEntry(vol, offset.ClusterNumber)
+		if err != nil {
+			return false, err
+		}
+		cluster &= 0x0fffffff
+		if cluster >= 0x0ffffff8 {
+			return true, nil
 		}
-		buf[offset.Offset] = 0xe5
+		// 簇链异常时保守处理，只保留删除标记
+		if cluster < 2 || cluster >= vol.ClusterCount()+2 {
+			return false, nil
+		}
+		next = &DirEntryOffset{ClusterNumber: cluster}
 	}
-	err = driver.WriteData(buf, uint64(sectorNum), 0)
+	buf, err := vol.Driver.ReadSector(vol.dEntrySector(next), 1)
 	if err != nil {
-		return err
+		return false, err
 	}
-	return nil
+	return buf[next.Offset%bytesPerSector] == 0, nil
 }
 
-// rmFAT32Link 删除指定的fat32链
-func rmFAT32Link(driver *DefaultDriver, fat32LL []uint32) error {
-	sectorNum := fat32LL[0]/128 + uint32(driver.Offset.DEntry)
-	buf, err := driver.ReadSector(uint64(sectorNum), 1)
+// rmDEntry 将目录项标记为已删除，fill 写入每个目录项的起始处
+func rmDEntry(vol *Volume, fill []byte, dEntryOffset []*DirEntryOffset) error {
+	bytesPerSector := uint32(vol.BPRSector.BytesPerSector)
+	sectorNum := vol.dEntrySector(dEntryOffset[0])
+	buf, err := vol.Driver.ReadSector(sectorNum, 1)
 	if err != nil {
 		return err
 	}
-	for _, i := range fat32LL {
-		if i >= 0x0ffffff8 {
-			err = driver.WriteData(buf, uint64(sectorNum), 0)
-			if err != nil {
-				return err
-			}
-			break
-		}
-		if sectorNum != i/128+uint32(driver.Offset.DEntry) {
-			err = driver.WriteData(buf, uint64(sectorNum), 0)
+	for _, offset := range dEntryOffset {
+		if sectorNum != vol.dEntrySector(offset) {
+			err = vol.writeMeta(buf, sectorNum)
 			if err != nil {
 				return err
 			}
-			sectorNum = i/128 + uint32(driver.Offset.DEntry)
-			buf, err = driver.ReadSector(uint64(sectorNum), 1)
+			sectorNum = vol.dEntrySector(offset)
+			buf, err = vol.Driver.ReadSector(sectorNum, 1)
 			if err != nil {
 				return err
 			}
 		}
-		offset := (i % 128) * 4
-		copy(buf[offset:], []byte{0, 0, 0, 0})
+		copy(buf[offset.Offset%bytesPerSector:], fill)
 	}
-	return nil
+	return vol.writeMeta(buf, sectorNum)
 }
 
-// cleanFileContent 依据fat32表簇号链清空文件内容
-func cleanFileContent(driver *DefaultDriver, fat32LL []uint32) error {
-	buf := make([]byte, 512)
+// rmFAT32Link 删除指定的fat32链，同步更新所有FAT表副本与FSInfo；簇链由 followChain 读取，不含结束标记
+func rmFAT32Link(vol *Volume, fat32LL []uint32) error {
+	var freed uint32
 	for _, i := range fat32LL {
-		if i >= 0x0ffffff8 {
-			break
+		entry, err := vol.fat.get(vol, i)
+		if err != nil {
+			return err
 		}
-		for j := 0; j < 8; j++ {
-			err := driver.WriteData(buf, uint64(driver.Offset.Data)+uint64((i-2)*uint32(driver.BPRSector.SectorsPerCluster)+uint32(j)), 0)
-			if err != nil {
-				return err
-			}
+		if entry&0x0fffffff != 0 {
+			freed++
 		}
-	}
-	return nil
-}
-
-// readFATEntry 读取某号fat表项指向的fat表项
-func readFATEntry(driver *DefaultDriver, FATEntry uint32) (uint32, error) {
-	fatOffset := FATEntry * 4 / uint32(driver.BPRSector.BytesPerSector)
-	fatBufferOffset := fatOffset % 32
-	fatBufferBase := fatOffset - fatBufferOffset
-	// 更新fat32表缓冲区
-	if fatBufferBase != FATBuffer.Number {
-		err := UpdateFAT(driver, fatBufferBase)
+		// 高4位为保留位，需保持不变
+		err = vol.fat.set(vol, i, entry&0xf0000000)
 		if err != nil {
-			return 0, err
+			return err
 		}
 	}
-	entryOffset := FATEntry - fatBufferBase*uint32(driver.BPRSector.BytesPerSector)
-	return FATBuffer.Link[entryOffset], nil
+	// FAT表写回后再更新FSInfo，中断时FSInfo的空闲簇数只会偏小
+	err := vol.fat.flush(vol)
+	if err != nil {
+		return err
+	}
+	return updateFSInfo(vol, freed, fat32LL[0])
 }
 
-// getFATLink 依据一条fat表项获取整个fat link
-func getFATLink(driver *DefaultDriver, FATEntry uint32) ([]uint32, error) {
-
-	i, err := readFATEntry(driver, FATEntry)
+// setFATEntry 将所有FAT表副本中的表项设置为 value，保留高4位
+func setFATEntry(vol *Volume, cluster uint32, value uint32) error {
+	entry, err := vol.fat.get(vol, cluster)
 	if err != nil {
-		return nil, err
+		return err
 	}
-	res := []uint32{FATEntry, i}
-	for i < 0x0ffffff8 {
-		i, err = readFATEntry(driver, i)
-		if err != nil {
-			return nil, err
+	err = vol.fat.set(vol, cluster, entry&0xf0000000|value&0x0fffffff)
+	if err != nil {
+		return err
+	}
+	return vol.fat.flush(vol)
+}
+
+// cleanFileContent 依据fat32表簇号链，按清除标准覆写文件内容；簇链不含结束标记
+func cleanFileContent(vol *Volume, opts *RemoveOptions, fat32LL []uint32) error {
+	var sectors []uint64
+	for _, i := range fat32LL {
+		for j := uint64(0); j < uint64(vol.BPRSector.SectorsPerCluster); j++ {
+			sectors = append(sectors, vol.clusterSector(i)+j)
 		}
-		res = append(res, i)
 	}
-	return res, nil
+	return opts.Wiper.wipeSectors(vol, sectors, opts.Verify)
+}
+
+// syncDriver 将驱动器已写入的数据同步到设备，驱动器不支持时忽略
+func syncDriver(driver Driver) error {
+	if syncer, ok := driver.(Syncer); ok {
+		return syncer.Sync()
+	}
+	return nil
+}
+
+// readFATEntry 读取某号fat表项指向的fat表项
+func readFATEntry(vol *Volume, FATEntry uint32) (uint32, error) {
+	return vol.fat.get(vol, FATEntry)
 }
 
 // getDriveFactory driver工厂函数，返回driver实例
-func getDriveFactory(absFileName string) (*DefaultDriver, error) {
-	var driver DefaultDriver
+func getDriveFactory(absFileName string, readOnly bool) (*DefaultDriver, error) {
+	driver := DefaultDriver{ReadOnly: readOnly}
 	err := driver.DInit(absFileName)
 	if err != nil {
 		return nil, err
@@ -336,58 +270,152 @@ func getDriveFactory(absFileName string) (*DefaultDriver, error) {
 	return &driver, nil
 }
 
-// UpdateFAT 更新fat32表缓冲区
-func UpdateFAT(driver *DefaultDriver, fatOffset uint32) error {
-	buffer, err := driver.ReadSector(uint64(driver.Offset.DEntry)+uint64(fatOffset), FAT32BufferSize)
+// parseBPR 将引导扇区的前512字节解析为FAT32BootSector
+func parseBPR(buffer []byte) (*FAT32BootSector, error) {
+	var fat32BootSector FAT32BootSector
+	err := binary.Read(bytes.NewReader(buffer), binary.LittleEndian, &fat32BootSector)
 	if err != nil {
-		return err
-	}
-	fat32l := make([]uint32, len(buffer)/4)
-	// 逐个解析每 4 字节为一个 uint32
-	for i := 0; i < len(fat32l); i++ {
-		fat32l[i] = binary.LittleEndian.Uint32(buffer[i*4 : (i+1)*4])
+		return nil, err
 	}
-	FATBuffer.Number = fatOffset
-	FATBuffer.Link = fat32l
-	return nil
+	return &fat32BootSector, nil
 }
 
-// RemoveFile 删除文件或文件夹
-func RemoveFile(absFileName string) error {
-	FATBuffer = &FAT32Buffer{}
-	driver, err := getDriveFactory(absFileName)
+// removeFromVolume 删除卷内的文件或目录树，path 为相对于卷根目录的路径，display 为输出时使用的路径
+// 仅输出计划时不写入设备
+func removeFromVolume(vol *Volume, opts *RemoveOptions, path, display string) error {
+	if path == "" {
+		return errors.New("can not remove volume root")
+	}
+	if opts.CodePage != nil {
+		vol.CodePage = opts.CodePage
+	}
+	if opts.Verify {
+		vol.Verifier = NewVerifier()
+	}
+	// dry-run 同样检查，卷为脏时与实际执行一样拒绝
+	err := checkClean(vol, opts.Force)
 	if err != nil {
 		return err
 	}
 
-	// 删除目录情况
-	var delFileList []string
-	stat, err := os.Stat(absFileName)
+	log.Println("Wipe standard:", opts.Wiper.Profile)
+	targets, err := collectTargets(vol, path, display)
 	if err != nil {
 		return err
 	}
 
-	if stat.IsDir() {
-		delFileList, err = listFiles(absFileName)
+	// 仅输出写入计划
+	if opts.DryRun {
+		plans, err := newPlanner(vol, opts)
+		if err != nil {
+			return err
+		}
+		dirty, clean, err := plans.planVolumeFlags()
 		if err != nil {
 			return err
 		}
-	} else {
-		delFileList = append(delFileList, absFileName)
+		printVolumeWrites(os.Stdout, "before the first write", dirty)
+		for _, target := range targets {
+			plan, err := plans.planRemoveFile(target.Path, target.DirEntry, target.Offsets)
+			if err != nil {
+				return err
+			}
+			printFilePlan(os.Stdout, plan)
+		}
+		printVolumeWrites(os.Stdout, "after all writes are synced", clean)
+		return nil
 	}
 
-	for _, fileName := range delFileList {
-		log.Println("Removing... ", fileName)
-		trimPath := strings.TrimPrefix(fileName, driver.Prefix+Segment)
-		dEntry, dEntryOffset, err := getDirEntry(driver, trimPath)
+	// 标记为脏之前检查所有簇链，因簇链损坏拒绝删除时卷保持不变，可以 --salvage 重试
+	chains := make([][]uint32, len(targets))
+	for i, target := range targets {
+		chains[i], err = removeChain(vol, opts, target.DirEntry)
+		if err != nil {
+			return fmt.Errorf("%s: %w", target.Path, err)
+		}
+	}
+	for i, target := range targets {
+		log.Println("Removing... ", target.Path)
+		err = markDirty(vol)
 		if err != nil {
 			return err
 		}
-		err = doRemoveFile(driver, dEntry, dEntryOffset)
+		err = removeFileChain(vol, opts, target.Path, target.DirEntry, chains[i], target.Offsets)
 		if err != nil {
 			return err
 		}
 	}
+	log.Println("Wiped", opts.Wiper.Stats)
+	return markClean(vol)
+}
+
+// RemoveFile 删除挂载卷上的文件或文件夹
+func RemoveFile(absFileName string, opts *RemoveOptions) error {
+	err := openJournal(opts, "", absFileName)
+	if err != nil {
+		return err
+	}
+	driver, err := getDriveFactory(absFileName, opts.DryRun)
+	if err != nil {
+		return err
+	}
+	vol, err := NewVolume(driver)
+	if err != nil {
+		return err
+	}
+	path, err := volumePath("", absFileName, driver.Prefix)
+	if err != nil {
+		return err
+	}
+	err = removeFromVolume(vol, opts, path, absFileName)
+	if err != nil {
+		return err
+	}
+	err = driver.DDestroy()
+	if err != nil {
+		return err
+	}
+	return opts.Journal.Close()
+}
 
-	return driver.DDestroy()
+// volumePath 返回相对于卷根目录、使用系统分隔符的路径，卷根目录为空字符串
+// image 非空时 target 为镜像内的路径，否则为挂载点 prefix 下的绝对路径
+func volumePath(image, target, prefix string) (string, error) {
+	if image != "" {
+		return strings.Join(splitVolumePath(target), Segment), nil
+	}
+	if !strings.HasPrefix(target, prefix) {
+		return "", errors.New("path is not on the mounted volume")
+	}
+	return strings.Join(splitVolumePath(strings.TrimPrefix(target, prefix)), Segment), nil
+}
+
+// RemoveImageFile 删除FAT32镜像文件中的文件或文件夹，filePath 为相对于卷根目录的路径
+func RemoveImageFile(imagePath string, filePath string, opts *RemoveOptions) error {
+	err := openJournal(opts, imagePath, filePath)
+	if err != nil {
+		return err
+	}
+	driver := ImageDriver{ReadOnly: opts.DryRun}
+	err = driver.DInit(imagePath)
+	if err != nil {
+		return err
+	}
+	vol, err := NewVolume(&driver)
+	if err != nil {
+		return err
+	}
+	path, err := volumePath(imagePath, filePath, "")
+	if err != nil {
+		return err
+	}
+	err = removeFromVolume(vol, opts, path, filepath.ToSlash(path))
+	if err != nil {
+		return err
+	}
+	err = driver.DDestroy()
+	if err != nil {
+		return err
+	}
+	return opts.Journal.Close()
 }
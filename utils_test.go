@@ -0,0 +1,242 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"testing"
+)
+
+// removePath 按 RemoveFile 的流程删除卷内单个文件
+func removePath(t testing.TB, vol *Volume, path string) {
+	t.Helper()
+	dEntry, dEntryOffset := lookup(t, vol, path)
+	wiper, err := NewWiper(WipeProfiles["zero"], nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = doRemoveFile(vol, &RemoveOptions{Wiper: wiper}, path, dEntry, dEntryOffset)
+	if err != nil {
+		t.Fatalf("remove %s: %v", path, err)
+	}
+}
+
+// expectRemoved 计算删除文件后应发生变化的全部字节，fats 为需要同步的FAT表序号
+func expectRemoved(vol *Volume, before *MemDriver, entry *BuildEntry, fats []uint32, want map[uint64]byte) {
+	bps := uint64(vol.BPRSector.BytesPerSector)
+	clusterSize := bps * uint64(vol.BPRSector.SectorsPerCluster)
+	lowest := uint32(fsInfoUnknown)
+	for i, cluster := range entry.Clusters {
+		// 文件内容清零
+		for j := uint64(0); j < clusterSize && uint64(i)*clusterSize+j < uint64(len(entry.Content)); j++ {
+			want[clusterAddr(vol, cluster)+j] = 0
+		}
+		// 每个FAT表副本中的表项清零
+		link := uint32(0x0fffffff)
+		if i+1 < len(entry.Clusters) {
+			link = entry.Clusters[i+1]
+		}
+		for _, fat := range fats {
+			fatAddr := (uint64(vol.Offset.DEntry)+uint64(fat)*uint64(vol.BPRSector.SectorsPerFAT32))*bps + uint64(cluster)*4
+			for k := uint64(0); k < 4; k++ {
+				if byte(link>>(8*k)) != 0 {
+					want[fatAddr+k] = 0
+				}
+			}
+		}
+		lowest = min(lowest, cluster)
+	}
+	// FSInfo 空闲簇数增加，空闲簇提示前移
+	if len(entry.Clusters) > 0 {
+		fsInfo, _ := before.ReadSector(uint64(vol.BPRSector.FSInfoSector), 1)
+		fsInfoAddr := uint64(vol.BPRSector.FSInfoSector) * bps
+		expectUint32(want, fsInfoAddr+fsInfoFreeCount, fsInfo[fsInfoFreeCount:], binary.LittleEndian.Uint32(fsInfo[fsInfoFreeCount:])+uint32(len(entry.Clusters)))
+		expectUint32(want, fsInfoAddr+fsInfoNextFree, fsInfo[fsInfoNextFree:], min(lowest, binary.LittleEndian.Uint32(fsInfo[fsInfoNextFree:])))
+	}
+	// 目录项首字节标记为已删除
+	for _, offset := range entry.Offsets {
+		want[clusterAddr(vol, offset.ClusterNumber)+uint64(offset.Offset)] = 0xe5
+	}
+}
+
+// expectUint32 记录一个小端 uint32 字段中发生变化的字节
+func expectUint32(want map[uint64]byte, addr uint64, old []byte, value uint32) {
+	for k := uint64(0); k < 4; k++ {
+		if old[k] != byte(value>>(8*k)) {
+			want[addr+k] = byte(value >> (8 * k))
+		}
+	}
+}
+
+// checkDiff 检查实际修改的字节与预期完全一致
+func checkDiff(t *testing.T, before, after *MemDriver, want map[uint64]byte) {
+	t.Helper()
+	got := diffBytes(before, after)
+	for addr, value := range want {
+		if got[addr] != value {
+			t.Errorf("byte %#x = %#x, want %#x", addr, got[addr], value)
+		}
+	}
+	for addr, value := range got {
+		if _, ok := want[addr]; !ok {
+			t.Errorf("unexpected write at %#x = %#x", addr, value)
+		}
+	}
+}
+
+func TestRemoveFileModifiedBytes(t *testing.T) {
+	for _, path := range []string{"docs/Report Final.txt", "frag.bin", "EMPTY.TXT", "single.txt"} {
+		t.Run(path, func(t *testing.T) {
+			b := NewVolumeBuilder(512, 8)
+			files := map[string]*BuildEntry{
+				"docs/Report Final.txt": b.AddFile("docs/Report Final.txt", fill(3*4096+100, 7)),
+				"frag.bin":              b.AddFileAt("frag.bin", fill(3*4096, 9), 40, 20, 60),
+				"EMPTY.TXT":             b.AddFile("EMPTY.TXT", nil),
+				"single.txt":            b.AddFile("single.txt", fill(10, 11)),
+			}
+			b.AddFile("keep.txt", fill(5000, 13))
+			driver, vol := buildVolume(t, b)
+			before := driver.Clone()
+			removePath(t, vol, path)
+
+			want := make(map[uint64]byte)
+			expectRemoved(vol, before, files[path], []uint32{0, 1}, want)
+			checkDiff(t, before, driver, want)
+			if _, _, err := getDirEntry(vol, path); err == nil {
+				t.Errorf("%s still found after remove", path)
+			}
+		})
+	}
+}
+
+func TestRemoveFileMirroringDisabled(t *testing.T) {
+	b := NewVolumeBuilder(512, 8)
+	b.NumFATs = 3
+	b.Flags = 0x81 // 镜像关闭，仅使用第2个FAT表
+	entry := b.AddFileAt("frag.bin", fill(3*4096, 9), 300, 30, 200)
+	driver, vol := buildVolume(t, b)
+	before := driver.Clone()
+	removePath(t, vol, "frag.bin")
+
+	want := make(map[uint64]byte)
+	expectRemoved(vol, before, entry, []uint32{1}, want)
+	checkDiff(t, before, driver, want)
+}
+
+func TestRemoveFileGeometries(t *testing.T) {
+	for _, bps := range []uint16{512, 1024, 2048, 4096} {
+		for _, spc := range []uint8{1, 2, 4, 8, 16, 32, 64, 128} {
+			t.Run(fmt.Sprintf("%d-%d", bps, spc), func(t *testing.T) {
+				t.Parallel()
+				clusterSize := int(bps) * int(spc)
+				b := NewVolumeBuilder(bps, spc)
+				// 目录项跨越多个扇区，簇号跨越多个FAT表缓冲区窗口
+				for i := 0; i < 40; i++ {
+					b.AddFile(fmt.Sprintf("dir/file number %02d.txt", i), fill(10, byte(i)))
+				}
+				nested := b.AddFile("dir/last file.bin", fill(2*clusterSize+100, 1))
+				frag := b.AddFileAt("frag.bin", fill(3*clusterSize, 2), 65000, 300, 40000)
+				driver, vol := buildVolume(t, b)
+
+				for path, entry := range map[string]*BuildEntry{"dir/last file.bin": nested, "frag.bin": frag} {
+					before := driver.Clone()
+					removePath(t, vol, path)
+					want := make(map[uint64]byte)
+					expectRemoved(vol, before, entry, []uint32{0, 1}, want)
+					checkDiff(t, before, driver, want)
+				}
+			})
+		}
+	}
+}
+
+func TestRemoveScrubEntries(t *testing.T) {
+	b := NewVolumeBuilder(512, 1)
+	middle := b.AddFile("Quarterly Budget Draft.xlsx", fill(700, 1))
+	b.AddFile("keep.txt", fill(100, 2))
+	tail := b.AddFile("Interview Notes 2024.txt", fill(900, 3))
+	_, vol := buildVolume(t, b)
+	wiper, _ := NewWiper(WipeProfiles["zero"], nil)
+	opts := &RemoveOptions{Wiper: wiper, ScrubEntries: true}
+
+	for _, entry := range []*BuildEntry{middle, tail} {
+		dEntry, dEntryOffset := lookup(t, vol, entry.Name)
+		if len(dEntryOffset) < 2 {
+			t.Fatalf("%s: expected long name entries, got %d", entry.Name, len(dEntryOffset))
+		}
+		err := doRemoveFile(vol, opts, entry.Name, dEntry, dEntryOffset)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// 目录中间的目录项只保留删除标记，目录末尾的目录项全部清零
+	for _, c := range []struct {
+		entry *BuildEntry
+		first byte
+	}{{middle, 0xe5}, {tail, 0}} {
+		for _, offset := range c.entry.Offsets {
+			buf, _ := vol.Driver.ReadSector(vol.dEntrySector(offset), 1)
+			start := offset.Offset % uint32(vol.BPRSector.BytesPerSector)
+			want := make([]byte, 32)
+			want[0] = c.first
+			if got := buf[start : start+32]; string(got) != string(want) {
+				t.Errorf("%s: entry at %d = %x, want %x", c.entry.Name, offset.Offset, got, want)
+			}
+		}
+		if _, _, err := getDirEntry(vol, c.entry.Name); err == nil {
+			t.Errorf("%s still found after remove", c.entry.Name)
+		}
+	}
+	lookup(t, vol, "keep.txt")
+}
+
+func TestRemoveDirectoryTree(t *testing.T) {
+	b := NewVolumeBuilder(512, 1)
+	var entries []*BuildEntry
+	entries = append(entries, b.AddDir("docs"), b.AddDir("docs/Project Alpha"), b.AddDir("docs/Project Alpha/empty"))
+	for i := 0; i < 20; i++ {
+		entries = append(entries, b.AddFile(fmt.Sprintf("docs/Project Alpha/Meeting Notes %02d.txt", i), fill(700, byte(i))))
+	}
+	entries = append(entries, b.AddFile("docs/readme.md", fill(100, 30)), b.AddFile("docs/EMPTY.TXT", nil))
+	keep := b.AddFile("keep.txt", fill(900, 31))
+	driver, vol := buildVolume(t, b)
+	fsInfo, _ := driver.ReadSector(uint64(vol.BPRSector.FSInfoSector), 1)
+	freeBefore := binary.LittleEndian.Uint32(fsInfo[fsInfoFreeCount:])
+	var clusters []uint32
+	for _, entry := range entries {
+		clusters = append(clusters, entry.Clusters...)
+	}
+	path := saveImage(t, driver)
+
+	wiper, _ := NewWiper(WipeProfiles["zero"], nil)
+	err := RemoveImageFile(path, "/docs", &RemoveOptions{Wiper: wiper})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	vol = openImage(t, path)
+	for _, cluster := range clusters {
+		if entry, _ := readFATEntry(vol, cluster); entry != 0 {
+			t.Errorf("cluster %d not freed: %#x", cluster, entry)
+		}
+		if buf := readCluster(t, vol, cluster); !bytes.Equal(buf, make([]byte, 512)) {
+			t.Errorf("cluster %d not wiped", cluster)
+		}
+	}
+	fsInfo, _ = readFSInfo(vol)
+	if free := binary.LittleEndian.Uint32(fsInfo[fsInfoFreeCount:]); free != freeBefore+uint32(len(clusters)) {
+		t.Errorf("free count %d, want %d", free, freeBefore+uint32(len(clusters)))
+	}
+	if _, _, err := getDirEntry(vol, "docs"); err == nil {
+		t.Error("docs still found after remove")
+	}
+	lookup(t, vol, "keep.txt")
+	var content []byte
+	for _, cluster := range keep.Clusters {
+		content = append(content, readCluster(t, vol, cluster)...)
+	}
+	if !bytes.Equal(content[:len(keep.Content)], keep.Content) {
+		t.Error("keep.txt modified")
+	}
+}
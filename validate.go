@@ -0,0 +1,74 @@
+package main
+
+import "fmt"
+
+// FAT32 簇数的上下限，簇数小于 minFAT32Clusters 的卷为FAT12/16
+const (
+	minFAT32Clusters = 65525
+	maxFAT32Clusters = 0x0ffffff5
+)
+
+// InvalidVolumeError 目标不是合法的FAT32卷，此时不会进行任何写入
+type InvalidVolumeError struct {
+	Reason string
+}
+
+func (e *InvalidVolumeError) Error() string {
+	return "not a valid FAT32 volume: " + e.Reason
+}
+
+func invalidVolume(format string, a ...any) error {
+	return &InvalidVolumeError{Reason: fmt.Sprintf(format, a...)}
+}
+
+// validateBPR 严格校验引导扇区，任何写入前都必须通过
+func validateBPR(bpr *FAT32BootSector) error {
+	if bpr.Signature != 0xaa55 {
+		return invalidVolume("boot sector signature %#04x, want 0xaa55", bpr.Signature)
+	}
+	switch bpr.BytesPerSector {
+	case 512, 1024, 2048, 4096:
+	default:
+		return invalidVolume("bytes per sector %d", bpr.BytesPerSector)
+	}
+	spc := bpr.SectorsPerCluster
+	if spc == 0 || spc&(spc-1) != 0 {
+		return invalidVolume("sectors per cluster %d", spc)
+	}
+	if bpr.ReservedSectors == 0 {
+		return invalidVolume("no reserved sectors")
+	}
+	if bpr.NumFATs == 0 {
+		return invalidVolume("no FAT")
+	}
+	// FAT32 不使用FAT12/16的字段
+	if bpr.MaxRootDirEntries != 0 || bpr.TotalSectors16 != 0 || bpr.SectorsPerFAT16 != 0 {
+		return invalidVolume("FAT12/16 fields in use")
+	}
+	// 镜像关闭时活动FAT表必须存在
+	if bpr.Flags&0x80 != 0 && uint8(bpr.Flags&0x0f) >= bpr.NumFATs {
+		return invalidVolume("active FAT %d of %d", bpr.Flags&0x0f, bpr.NumFATs)
+	}
+	if bpr.SectorsPerFAT32 == 0 || bpr.TotalSectors32 == 0 {
+		return invalidVolume("zero FAT size or total sectors")
+	}
+
+	metaSectors := uint64(bpr.ReservedSectors) + uint64(bpr.NumFATs)*uint64(bpr.SectorsPerFAT32)
+	if metaSectors >= uint64(bpr.TotalSectors32) {
+		return invalidVolume("FAT area exceeds volume")
+	}
+	clusters := (uint64(bpr.TotalSectors32) - metaSectors) / uint64(spc)
+	if clusters < minFAT32Clusters || clusters > maxFAT32Clusters {
+		return invalidVolume("%d clusters out of FAT32 range", clusters)
+	}
+	if uint64(bpr.SectorsPerFAT32)*uint64(bpr.BytesPerSector)/4 < clusters+2 {
+		return invalidVolume("FAT too small for %d clusters", clusters)
+	}
+	if bpr.RootCluster < 2 || uint64(bpr.RootCluster) >= clusters+2 {
+		return invalidVolume("root cluster %d out of range", bpr.RootCluster)
+	}
+	if bpr.FSInfoSector != 0 && bpr.FSInfoSector != 0xffff && bpr.FSInfoSector >= bpr.ReservedSectors {
+		return invalidVolume("FSInfo sector %d outside reserved area", bpr.FSInfoSector)
+	}
+	return nil
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"testing"
+)
+
+func TestNewVolumeRejectsInvalidBootSector(t *testing.T) {
+	tests := []struct {
+		name   string
+		mutate func(boot []byte)
+	}{
+		{"signature", func(boot []byte) { boot[510] = 0 }},
+		{"bytes per sector", func(boot []byte) { binary.LittleEndian.PutUint16(boot[0x0b:], 500) }},
+		{"sectors per cluster", func(boot []byte) { boot[0x0d] = 3 }},
+		{"no FAT", func(boot []byte) { boot[0x10] = 0 }},
+		{"FAT16 root entries", func(boot []byte) { binary.LittleEndian.PutUint16(boot[0x11:], 512) }},
+		{"FAT16 size", func(boot []byte) { binary.LittleEndian.PutUint16(boot[0x16:], 256) }},
+		{"too few clusters", func(boot []byte) { binary.LittleEndian.PutUint32(boot[0x20:], 40000) }},
+		{"FAT too small", func(boot []byte) { binary.LittleEndian.PutUint32(boot[0x24:], 16) }},
+		{"root cluster", func(boot []byte) { binary.LittleEndian.PutUint32(boot[0x2c:], 1) }},
+		{"ext4 superblock", func(boot []byte) { clear(boot) }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			driver, err := NewVolumeBuilder(512, 8).Build()
+			if err != nil {
+				t.Fatal(err)
+			}
+			boot, _ := driver.ReadSector(0, 1)
+			tt.mutate(boot)
+			_ = driver.WriteData(boot, 0, 0)
+			before := driver.Clone()
+
+			_, err = NewVolume(driver)
+			var invalid *InvalidVolumeError
+			if !errors.As(err, &invalid) {
+				t.Fatalf("NewVolume error = %v, want InvalidVolumeError", err)
+			}
+			if diff := diffBytes(before, driver); len(diff) != 0 {
+				t.Errorf("%d bytes written to invalid volume", len(diff))
+			}
+		})
+	}
+}
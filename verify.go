@@ -0,0 +1,73 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// VerifyError 回读校验失败，Sectors 为内容与预期不一致的扇区
+type VerifyError struct {
+	Sectors []uint64
+}
+
+func (e *VerifyError) Error() string {
+	nums := make([]string, len(e.Sectors))
+	for i, sectorNum := range e.Sectors {
+		nums[i] = fmt.Sprint(sectorNum)
+	}
+	return fmt.Sprintf("verify failed, %d sectors mismatch: %s", len(e.Sectors), strings.Join(nums, ", "))
+}
+
+// Verifier 记录修改过的元数据扇区（FAT表、FSInfo、目录项）的预期内容，用于写入后回读校验
+type Verifier struct {
+	expected map[uint64][]byte
+}
+
+func NewVerifier() *Verifier {
+	return &Verifier{expected: make(map[uint64][]byte)}
+}
+
+// record 记录扇区写入后的预期内容
+func (v *Verifier) record(sectorNum uint64, data []byte) {
+	v.expected[sectorNum] = append([]byte(nil), data...)
+}
+
+// Check 回读所有记录的扇区并与预期内容比较，完成后清空记录
+func (v *Verifier) Check(driver Driver) error {
+	nums := make([]uint64, 0, len(v.expected))
+	for sectorNum := range v.expected {
+		nums = append(nums, sectorNum)
+	}
+	sort.Slice(nums, func(i, j int) bool {
+		return nums[i] < nums[j]
+	})
+	var mismatch []uint64
+	for _, sectorNum := range nums {
+		got, err := readDirect(driver, sectorNum, 1)
+		if err != nil {
+			return err
+		}
+		if !bytes.Equal(got, v.expected[sectorNum]) {
+			mismatch = append(mismatch, sectorNum)
+		}
+	}
+	v.expected = make(map[uint64][]byte)
+	if len(mismatch) > 0 {
+		return &VerifyError{Sectors: mismatch}
+	}
+	return nil
+}
+
+// readDirect 尽可能绕过页缓存读取扇区，驱动器不支持时先同步再读取
+func readDirect(driver Driver, sectorNum uint64, readNum uint16) ([]byte, error) {
+	if reader, ok := driver.(DirectReader); ok {
+		return reader.ReadSectorDirect(sectorNum, readNum)
+	}
+	err := syncDriver(driver)
+	if err != nil {
+		return nil, err
+	}
+	return driver.ReadSector(sectorNum, readNum)
+}
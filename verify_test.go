@@ -0,0 +1,63 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestRemoveVerifyMetadata(t *testing.T) {
+	b := NewVolumeBuilder(512, 4)
+	b.AddFile("data.bin", fill(4096, 1))
+	driver, vol := buildVolume(t, b)
+	dEntry, dEntryOffset := lookup(t, vol, "data.bin")
+
+	// 丢弃第二个FAT表副本的写入
+	cluster := uint32(dEntry.ClusterLow)
+	dropped := uint64(vol.Offset.DEntry) + uint64(vol.BPRSector.SectorsPerFAT32) + uint64(cluster/128)
+	vol.Driver = &dropDriver{MemDriver: driver, drop: dropped}
+	vol.Verifier = NewVerifier()
+
+	wiper, err := NewWiper(WipeProfiles["zero"], nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = doRemoveFile(vol, &RemoveOptions{Wiper: wiper, Verify: true}, "data.bin", dEntry, dEntryOffset)
+	var verifyErr *VerifyError
+	if !errors.As(err, &verifyErr) {
+		t.Fatalf("error = %v, want VerifyError", err)
+	}
+	if len(verifyErr.Sectors) != 1 || verifyErr.Sectors[0] != dropped {
+		t.Errorf("mismatching sectors %v, want [%d]", verifyErr.Sectors, dropped)
+	}
+}
+
+func TestRemoveVerifyData(t *testing.T) {
+	b := NewVolumeBuilder(512, 4)
+	b.AddFile("data.bin", fill(4096, 1))
+	driver, vol := buildVolume(t, b)
+	dEntry, dEntryOffset := lookup(t, vol, "data.bin")
+	dropped := vol.clusterSector(uint32(dEntry.ClusterLow)) + 1
+	vol.Driver = &dropDriver{MemDriver: driver, drop: dropped}
+	vol.Verifier = NewVerifier()
+
+	wiper, err := NewWiper(WipeProfiles["zero"], nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = doRemoveFile(vol, &RemoveOptions{Wiper: wiper, Verify: true}, "data.bin", dEntry, dEntryOffset)
+	var verifyErr *VerifyError
+	if !errors.As(err, &verifyErr) || len(verifyErr.Sectors) != 1 || verifyErr.Sectors[0] != dropped {
+		t.Fatalf("error = %v, want mismatch at sector %d", err, dropped)
+	}
+
+	// 所有写入均成功时校验通过
+	b = NewVolumeBuilder(512, 4)
+	b.AddFile("data.bin", fill(4096, 1))
+	_, vol = buildVolume(t, b)
+	vol.Verifier = NewVerifier()
+	dEntry, dEntryOffset = lookup(t, vol, "data.bin")
+	err = doRemoveFile(vol, &RemoveOptions{Wiper: wiper, Verify: true}, "data.bin", dEntry, dEntryOffset)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,117 @@
+package main
+
+// Volume FAT32卷，持有卷的几何信息与FAT表缓存
+// 可构建于任意 Driver 之上，镜像文件、内存磁盘与远程块设备均可复用同一套FAT逻辑
+type Volume struct {
+	Driver    Driver
+	BPRSector *FAT32BootSector
+	Offset    *FAT32Offset
+	Verifier  *Verifier // 非空时记录元数据写入，用于回读校验
+	CodePage  *CodePage // 短文件名使用的OEM代码页
+	KeepDirty bool      // 卷在操作前已被标记为脏，操作完成后不清除脏标记
+	dirty     bool      // 本次操作已将卷标记为脏
+	fat       *fatCache
+}
+
+// NewVolume 读取并校验驱动器的引导扇区，计算偏移并加载首个FAT表窗口
+func NewVolume(driver Driver) (*Volume, error) {
+	buffer, err := driver.ReadSector(0, 1)
+	if err != nil {
+		return nil, err
+	}
+	if len(buffer) < 512 {
+		return nil, invalidVolume("boot sector too short")
+	}
+	bpr, err := parseBPR(buffer[:512])
+	if err != nil {
+		return nil, err
+	}
+	// 校验失败时直接返回，避免依据错误的偏移覆盖其他文件系统
+	err = validateBPR(bpr)
+	if err != nil {
+		return nil, err
+	}
+	vol := &Volume{
+		Driver:    driver,
+		BPRSector: bpr,
+		CodePage:  DefaultCodePage,
+		fat:       newFATCache(fatCacheWindows),
+	}
+	// 初始化计算重要偏移处
+	vol.Offset = &FAT32Offset{}
+	vol.Offset.DEntry = uint(bpr.ReservedSectors)
+	vol.Offset.Data = uint32(vol.Offset.DEntry) + uint32(bpr.NumFATs)*bpr.SectorsPerFAT32
+	_, err = readFATEntry(vol, 0)
+	if err != nil {
+		return nil, err
+	}
+	return vol, nil
+}
+
+// activeFAT 返回当前使用的FAT表序号，Flags 第7位置位时镜像关闭，由低4位指定活动FAT表
+func (vol *Volume) activeFAT() uint32 {
+	if vol.BPRSector.Flags&0x80 != 0 {
+		return uint32(vol.BPRSector.Flags & 0x0f)
+	}
+	return 0
+}
+
+// fatSector 返回活动FAT表中第n个扇区的扇区号
+func (vol *Volume) fatSector(n uint32) uint64 {
+	return vol.fatCopySector(vol.activeFAT(), n)
+}
+
+// fatCopies 返回修改FAT表时需要同步的FAT表序号，镜像关闭时仅有活动FAT表
+func (vol *Volume) fatCopies() []uint32 {
+	if vol.BPRSector.Flags&0x80 != 0 {
+		return []uint32{vol.activeFAT()}
+	}
+	copies := make([]uint32, vol.BPRSector.NumFATs)
+	for i := range copies {
+		copies[i] = uint32(i)
+	}
+	return copies
+}
+
+// fatCopySector 返回第i个FAT表副本中第n个扇区的扇区号
+func (vol *Volume) fatCopySector(i uint32, n uint32) uint64 {
+	return uint64(vol.Offset.DEntry) + uint64(i)*uint64(vol.BPRSector.SectorsPerFAT32) + uint64(n)
+}
+
+// writeFATSector 将FAT表第n个扇区写入所有需要同步的FAT表副本，只由FAT表缓存写回时调用
+func (vol *Volume) writeFATSector(n uint32, buf []byte) error {
+	for _, i := range vol.fatCopies() {
+		err := vol.writeMeta(buf, vol.fatCopySector(i, n))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ClusterCount 返回数据区的簇数
+func (vol *Volume) ClusterCount() uint32 {
+	return (vol.BPRSector.TotalSectors32 - vol.Offset.Data) / uint32(vol.BPRSector.SectorsPerCluster)
+}
+
+// clusterSector 返回簇的起始扇区号
+func (vol *Volume) clusterSector(cluster uint32) uint64 {
+	return uint64(vol.Offset.Data) + uint64(cluster-2)*uint64(vol.BPRSector.SectorsPerCluster)
+}
+
+// dEntrySector 返回目录项所在的扇区号
+func (vol *Volume) dEntrySector(offset *DirEntryOffset) uint64 {
+	return vol.clusterSector(offset.ClusterNumber) + uint64(offset.Offset/uint32(vol.BPRSector.BytesPerSector))
+}
+
+// writeMeta 写入一个完整的元数据扇区，需要校验时记录其预期内容
+func (vol *Volume) writeMeta(buf []byte, sectorNum uint64) error {
+	err := vol.Driver.WriteData(buf, sectorNum, 0)
+	if err != nil {
+		return err
+	}
+	if vol.Verifier != nil {
+		vol.Verifier.record(sectorNum, buf)
+	}
+	return nil
+}
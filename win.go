@@ -3,8 +3,6 @@
 package main
 
 import (
-	"bytes"
-	"encoding/binary"
 	"errors"
 	"golang.org/x/sys/windows"
 	"log"
@@ -21,13 +19,17 @@ type DefaultDriver struct {
 	Handle    windows.Handle
 	Prefix    string
 	BPRSector *FAT32BootSector
-	Offset    *FAT32Offset
+	ReadOnly  bool // 只读打开设备，用于 dry-run
 }
 
 func (d *DefaultDriver) DInit(absFileName string) error {
 	var err error
 	volName := filepath.VolumeName(absFileName)
-	d.Handle, err = openPartition(volName)
+	err = checkFileSystem(volName)
+	if err != nil {
+		return err
+	}
+	d.Handle, err = openPartition(volName, d.ReadOnly)
 	d.Prefix = volName
 
 	if err != nil {
@@ -37,16 +39,12 @@ func (d *DefaultDriver) DInit(absFileName string) error {
 	if err != nil {
 		return err
 	}
-	// 初始化计算重要偏移处
-	d.Offset = &FAT32Offset{}
-	d.Offset.DEntry = uint(d.BPRSector.ReservedSectors)
-	d.Offset.Data = uint32(d.Offset.DEntry) + 2*uint32(d.BPRSector.SectorsPerFAT32)
-	return UpdateFAT(d, 0)
+	return nil
 }
 
 func (d *DefaultDriver) ReadSector(sectorNum uint64, readNum uint16) ([]byte, error) {
 	var bytesRead uint32
-	bufferSize := d.BPRSector.BytesPerSector * readNum
+	bufferSize := int(d.BPRSector.BytesPerSector) * int(readNum)
 	buffer := make([]byte, bufferSize)
 
 	// 修改句柄偏移
@@ -83,20 +81,26 @@ func (d *DefaultDriver) WriteData(data []byte, sectorNum uint64, offset uint16)
 	}()
 
 	var buf []byte
-	if len(data) < int(d.BPRSector.BytesPerSector) {
+	bytesPerSector := int(d.BPRSector.BytesPerSector)
+	if len(data) < bytesPerSector {
+		if int(offset)+len(data) > bytesPerSector {
+			return errors.New("data crosses sector boundary")
+		}
 		// 创建写入缓冲区
 		buf, err = d.ReadSector(sectorNum, 1)
 		if err != nil {
 			return err
 		}
 		copy(buf[offset:], data)
-	} else if len(data) > int(d.BPRSector.BytesPerSector) {
-		return errors.New("data len longer than one sector")
+	} else if offset != 0 || len(data)%bytesPerSector != 0 {
+		// 多个扇区需以整扇区写入，卷句柄只接受扇区对齐的读写
+		return errors.New("data longer than one sector must be whole sectors")
 	} else {
 		buf = data
 	}
 
-	offsetByte := int64(d.BPRSector.BytesPerSector)*int64(sectorNum) + int64(offset)
+	// 缓冲区为完整扇区，需从扇区起始处写入
+	offsetByte := int64(d.BPRSector.BytesPerSector) * int64(sectorNum)
 	high := int32(offsetByte >> 32)
 	low := int32(offsetByte & 0xFFFFFFFF)
 	_, err = windows.SetFilePointer(
@@ -119,19 +123,39 @@ func (d *DefaultDriver) WriteData(data []byte, sectorNum uint64, offset uint16)
 	if err != nil {
 		return err
 	}
+	if int(written) != len(buf) {
+		return errors.New("short write")
+	}
 	return nil
 }
 
+func (d *DefaultDriver) Sync() error {
+	return windows.FlushFileBuffers(d.Handle)
+}
+
+// ReadSectorDirect 刷新缓冲区后读取扇区，确保读到设备上的实际内容
+func (d *DefaultDriver) ReadSectorDirect(sectorNum uint64, readNum uint16) ([]byte, error) {
+	err := windows.FlushFileBuffers(d.Handle)
+	if err != nil {
+		return nil, err
+	}
+	return d.ReadSector(sectorNum, readNum)
+}
+
 func (d *DefaultDriver) DDestroy() error {
 	return windows.CloseHandle(d.Handle)
 }
 
-// openPartition 打开逻辑分区 示例 openPartition(`D:`)
-func openPartition(partitionName string) (windows.Handle, error) {
+// openPartition 打开逻辑分区 示例 openPartition(`D:`, false)
+func openPartition(partitionName string, readOnly bool) (windows.Handle, error) {
+	access := uint32(windows.GENERIC_ALL)
+	if readOnly {
+		access = windows.GENERIC_READ
+	}
 	// 创建句柄
 	partitionHandle, err := windows.CreateFile(
 		windows.StringToUTF16Ptr(`\\.\`+partitionName),
-		windows.GENERIC_ALL,
+		access,
 		windows.FILE_SHARE_READ|windows.FILE_SHARE_WRITE,
 		nil,
 		windows.OPEN_EXISTING,
@@ -145,24 +169,41 @@ func openPartition(partitionName string) (windows.Handle, error) {
 	return partitionHandle, nil
 }
 
+// checkFileSystem 确认分区的文件系统为FAT32
+func checkFileSystem(volName string) error {
+	fsName := make([]uint16, windows.MAX_PATH+1)
+	err := windows.GetVolumeInformation(
+		windows.StringToUTF16Ptr(volName+`\`),
+		nil,
+		0,
+		nil,
+		nil,
+		nil,
+		&fsName[0],
+		uint32(len(fsName)),
+	)
+	if err != nil {
+		return err
+	}
+	if name := windows.UTF16ToString(fsName); name != "FAT32" {
+		return invalidVolume("%s file system is %s", volName, name)
+	}
+	return nil
+}
+
 // getBPR 读取FAT32引导扇区(BPR)
 func getBPR(handle windows.Handle) (*FAT32BootSector, error) {
 	var bytesRead uint32
-	var fat32BootSector FAT32BootSector
-	var buffer [512]byte
-	// 读取分卷的前512字节，即BPR，并解析到BPRSector中
+	// 扇区大小未知，按最大扇区4096字节对齐读取，BPR位于前512字节
+	var buffer [4096]byte
 	err := windows.ReadFile(handle, (&buffer)[:], &bytesRead, nil)
 	if err != nil {
 		return nil, err
 	}
-	if bytesRead != 512 {
+	if bytesRead < 512 {
 		return nil, errors.New("read sector error")
 	}
-	err = binary.Read(bytes.NewReader(buffer[:bytesRead]), binary.LittleEndian, &fat32BootSector)
-	if err != nil {
-		return nil, err
-	}
-	return &fat32BootSector, nil
+	return parseBPR(buffer[:512])
 }
 
 func lockVolume(handle windows.Handle) error {
@@ -0,0 +1,353 @@
+package main
+
+import (
+	"bytes"
+	crand "crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+// DefaultWipeBufferSize 单次覆写写入的默认最大字节数
+const DefaultWipeBufferSize = 1 << 20
+
+// WipePass 一遍覆写，Random 为真时写入随机数据，否则循环填充 Pattern
+type WipePass struct {
+	Pattern []byte
+	Random  bool
+}
+
+// WipeProfile 数据清除标准，由若干遍覆写组成
+type WipeProfile struct {
+	Name   string
+	Passes []WipePass
+	Verify bool // 最后一遍写入后回读校验
+}
+
+func fixedPass(pattern ...byte) WipePass {
+	return WipePass{Pattern: pattern}
+}
+
+var randomPass = WipePass{Random: true}
+
+// gutmannPasses Gutmann 35遍覆写：4遍随机、27遍固定模式、4遍随机
+func gutmannPasses() []WipePass {
+	passes := []WipePass{randomPass, randomPass, randomPass, randomPass,
+		fixedPass(0x55), fixedPass(0xaa),
+		fixedPass(0x92, 0x49, 0x24), fixedPass(0x49, 0x24, 0x92), fixedPass(0x24, 0x92, 0x49)}
+	for i := 0; i < 16; i++ {
+		passes = append(passes, fixedPass(byte(i*0x11)))
+	}
+	passes = append(passes,
+		fixedPass(0x92, 0x49, 0x24), fixedPass(0x49, 0x24, 0x92), fixedPass(0x24, 0x92, 0x49),
+		fixedPass(0x6d, 0xb6, 0xdb), fixedPass(0xb6, 0xdb, 0x6d), fixedPass(0xdb, 0x6d, 0xb6),
+		randomPass, randomPass, randomPass, randomPass)
+	return passes
+}
+
+// WipeProfiles 可选的清除标准
+var WipeProfiles = map[string]WipeProfile{
+	"zero":   {Name: "zero", Passes: []WipePass{fixedPass(0x00)}},
+	"one":    {Name: "one", Passes: []WipePass{fixedPass(0xff)}},
+	"random": {Name: "random", Passes: []WipePass{randomPass}},
+	// DoD 5220.22-M：字符、补码、随机
+	"dod3": {Name: "dod3", Passes: []WipePass{fixedPass(0x00), fixedPass(0xff), randomPass}, Verify: true},
+	// DoD 5220.22-M ECE：两次 DoD 3遍覆写之间插入一遍单字符覆写
+	"dod7": {Name: "dod7", Passes: []WipePass{
+		fixedPass(0x00), fixedPass(0xff), randomPass, fixedPass(0x96),
+		fixedPass(0x00), fixedPass(0xff), randomPass,
+	}, Verify: true},
+	"gutmann": {Name: "gutmann", Passes: gutmannPasses()},
+	// NIST 800-88 Clear：一遍覆写并校验
+	"nist": {Name: "nist", Passes: []WipePass{fixedPass(0x00)}, Verify: true},
+}
+
+// WipeProfileNames 返回所有清除标准名称，用于命令行帮助
+func WipeProfileNames() []string {
+	names := make([]string, 0, len(WipeProfiles))
+	for name := range WipeProfiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ParseWipePattern 解析自定义覆写模式，以逗号分隔每一遍，如 0x00,0xff,random,0x9249
+func ParseWipePattern(pattern string) (WipeProfile, error) {
+	profile := WipeProfile{Name: "custom"}
+	for _, field := range strings.Split(pattern, ",") {
+		field = strings.TrimSpace(field)
+		if strings.EqualFold(field, "random") {
+			profile.Passes = append(profile.Passes, randomPass)
+			continue
+		}
+		digits := strings.TrimPrefix(strings.ToLower(field), "0x")
+		if len(digits)%2 == 1 {
+			digits = "0" + digits
+		}
+		b, err := hex.DecodeString(digits)
+		if err != nil || len(b) == 0 {
+			return WipeProfile{}, fmt.Errorf("invalid pattern %q", field)
+		}
+		profile.Passes = append(profile.Passes, fixedPass(b...))
+	}
+	return profile, nil
+}
+
+// WipeStats 覆写的字节数、写入次数与耗时，用于报告吞吐量
+type WipeStats struct {
+	Bytes   uint64
+	Writes  uint64
+	Elapsed time.Duration
+}
+
+func (s WipeStats) String() string {
+	rate := 0.0
+	if s.Elapsed > 0 {
+		rate = float64(s.Bytes) / (1 << 20) / s.Elapsed.Seconds()
+	}
+	return fmt.Sprintf("%d bytes in %d writes, %s (%.1f MiB/s)", s.Bytes, s.Writes, s.Elapsed.Round(time.Millisecond), rate)
+}
+
+// Wiper 依据清除标准生成每一遍的覆写数据
+// 随机数据由 ChaCha8 生成，每一遍使用由种子派生的独立数据流，以便回读校验时重新生成
+type Wiper struct {
+	Profile    WipeProfile
+	BufferSize int       // 单次写入的最大字节数，向下取整为扇区大小的倍数
+	Stats      WipeStats // 累计的覆写统计
+	seed       [32]byte
+	stream     *rand.ChaCha8
+}
+
+// NewWiper 创建覆写器，seed 为空时使用系统随机数作为种子
+func NewWiper(profile WipeProfile, seed []byte) (*Wiper, error) {
+	if len(profile.Passes) == 0 {
+		return nil, fmt.Errorf("wipe profile %s has no pass", profile.Name)
+	}
+	w := &Wiper{Profile: profile, BufferSize: DefaultWipeBufferSize}
+	if seed == nil {
+		_, err := crand.Read(w.seed[:])
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		w.seed = sha256.Sum256(seed)
+	}
+	return w, nil
+}
+
+// ParseSeed 解析命令行中的随机种子，可为十六进制或任意字符串
+func ParseSeed(seed string) []byte {
+	if seed == "" {
+		return nil
+	}
+	if b, err := hex.DecodeString(seed); err == nil {
+		return b
+	}
+	return []byte(seed)
+}
+
+// beginPass 开始第n遍覆写，依据遍数与首个扇区号派生该遍的随机数据流
+func (w *Wiper) beginPass(n int, key uint64) {
+	if !w.Profile.Passes[n].Random {
+		return
+	}
+	seed := w.seed
+	binary.LittleEndian.PutUint64(seed[16:], binary.LittleEndian.Uint64(seed[16:])^key)
+	binary.LittleEndian.PutUint64(seed[24:], binary.LittleEndian.Uint64(seed[24:])^uint64(n+1))
+	w.stream = rand.NewChaCha8(seed)
+}
+
+// fill 生成第n遍覆写在字节地址 addr 处的数据，固定模式按卷内绝对位置对齐
+func (w *Wiper) fill(buf []byte, n int, addr uint64) {
+	pass := w.Profile.Passes[n]
+	if pass.Random {
+		for i := 0; i < len(buf); i += 8 {
+			var word [8]byte
+			binary.LittleEndian.PutUint64(word[:], w.stream.Uint64())
+			copy(buf[i:], word[:])
+		}
+		return
+	}
+	phase := int(addr % uint64(len(pass.Pattern)))
+	for i := range buf {
+		buf[i] = pass.Pattern[(phase+i)%len(pass.Pattern)]
+	}
+}
+
+// sectorRun 一段连续的扇区
+type sectorRun struct {
+	Start uint64
+	Count uint64
+}
+
+// sectorRuns 将扇区排序去重后合并为连续的扇区段，每段不超过 maxSectors 个扇区
+// 且不跨越 maxSectors 的整数倍边界，大块写入在设备上保持对齐
+func sectorRuns(sectors []uint64, maxSectors uint64) []sectorRun {
+	sorted := append([]uint64(nil), sectors...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i] < sorted[j]
+	})
+	var runs []sectorRun
+	for _, sectorNum := range sorted {
+		if n := len(runs); n > 0 {
+			last := &runs[n-1]
+			end := last.Start + last.Count
+			if sectorNum < end {
+				continue
+			}
+			if sectorNum == end && end%maxSectors != 0 {
+				last.Count++
+				continue
+			}
+		}
+		runs = append(runs, sectorRun{Start: sectorNum, Count: 1})
+	}
+	return runs
+}
+
+// runs 按覆写器的缓冲区大小划分扇区段，回读校验时一次读取的扇区数不能超过 uint16 的范围
+func (w *Wiper) runs(vol *Volume, sectors []uint64) []sectorRun {
+	bytesPerSector := uint64(vol.BPRSector.BytesPerSector)
+	return sectorRuns(sectors, min(max(uint64(w.BufferSize)/bytesPerSector, 1), math.MaxUint16))
+}
+
+// wipeSectors 按清除标准的每一遍覆写一组扇区，各遍之间同步到设备
+// 扇区按顺序合并为连续的扇区段，每段以一次写入完成；清除标准要求校验或 verify 为真时，回读确认最后一遍的内容
+func (w *Wiper) wipeSectors(vol *Volume, sectors []uint64, verify bool) error {
+	if len(sectors) == 0 {
+		return nil
+	}
+	bytesPerSector := uint64(vol.BPRSector.BytesPerSector)
+	runs := w.runs(vol, sectors)
+	var largest uint64
+	for _, run := range runs {
+		largest = max(largest, run.Count)
+	}
+	buf := make([]byte, largest*bytesPerSector)
+	begin := time.Now()
+	for n := range w.Profile.Passes {
+		// 随机数据流按扇区顺序连续生成，与逐扇区写入的内容一致
+		w.beginPass(n, runs[0].Start)
+		for _, run := range runs {
+			data := buf[:run.Count*bytesPerSector]
+			w.fill(data, n, run.Start*bytesPerSector)
+			err := vol.Driver.WriteData(data, run.Start, 0)
+			if err != nil {
+				return err
+			}
+			w.Stats.Bytes += uint64(len(data))
+			w.Stats.Writes++
+		}
+		err := syncDriver(vol.Driver)
+		if err != nil {
+			return err
+		}
+	}
+	w.Stats.Elapsed += time.Since(begin)
+	if w.Profile.Verify || verify {
+		return w.verifySectors(vol, runs)
+	}
+	return nil
+}
+
+// wipeSectorTail 按清除标准覆写扇区中从 from 开始的字节，之前的内容保持不变
+func (w *Wiper) wipeSectorTail(vol *Volume, sectorNum uint64, from int, verify bool) error {
+	orig, err := vol.Driver.ReadSector(sectorNum, 1)
+	if err != nil {
+		return err
+	}
+	buf := make([]byte, len(orig))
+	begin := time.Now()
+	for n := range w.Profile.Passes {
+		w.beginPass(n, sectorNum)
+		w.fill(buf, n, sectorNum*uint64(len(buf)))
+		copy(buf[:from], orig[:from])
+		err = vol.Driver.WriteData(buf, sectorNum, 0)
+		if err != nil {
+			return err
+		}
+		w.Stats.Bytes += uint64(len(buf) - from)
+		w.Stats.Writes++
+		err = syncDriver(vol.Driver)
+		if err != nil {
+			return err
+		}
+	}
+	w.Stats.Elapsed += time.Since(begin)
+	if w.Profile.Verify || verify {
+		got, err := readDirect(vol.Driver, sectorNum, 1)
+		if err != nil {
+			return err
+		}
+		if !bytes.Equal(got, buf) {
+			return &VerifyError{Sectors: []uint64{sectorNum}}
+		}
+	}
+	return nil
+}
+
+// verifySectors 回读扇区段，确认其内容与最后一遍覆写一致，返回所有不一致的扇区
+func (w *Wiper) verifySectors(vol *Volume, runs []sectorRun) error {
+	last := len(w.Profile.Passes) - 1
+	bytesPerSector := uint64(vol.BPRSector.BytesPerSector)
+	var mismatch []uint64
+	w.beginPass(last, runs[0].Start)
+	for _, run := range runs {
+		want := make([]byte, run.Count*bytesPerSector)
+		w.fill(want, last, run.Start*bytesPerSector)
+		got, err := readDirect(vol.Driver, run.Start, uint16(run.Count))
+		if err != nil {
+			return err
+		}
+		for i := uint64(0); i < run.Count; i++ {
+			sector := want[i*bytesPerSector : (i+1)*bytesPerSector]
+			if uint64(len(got)) < (i+1)*bytesPerSector || !bytes.Equal(got[i*bytesPerSector:(i+1)*bytesPerSector], sector) {
+				mismatch = append(mismatch, run.Start+i)
+			}
+		}
+	}
+	if len(mismatch) > 0 {
+		return &VerifyError{Sectors: mismatch}
+	}
+	return nil
+}
+
+// ParseWipeProfile 依据命令行选项选择清除标准，pattern 非空时使用自定义模式
+func ParseWipeProfile(name string, pattern string, verify bool) (WipeProfile, error) {
+	var profile WipeProfile
+	if pattern != "" {
+		var err error
+		profile, err = ParseWipePattern(pattern)
+		if err != nil {
+			return WipeProfile{}, err
+		}
+	} else {
+		var ok bool
+		profile, ok = WipeProfiles[name]
+		if !ok {
+			return WipeProfile{}, fmt.Errorf("unknown wipe standard %q, available: %s", name, strings.Join(WipeProfileNames(), ", "))
+		}
+	}
+	profile.Verify = profile.Verify || verify
+	return profile, nil
+}
+
+// samePasses 两个清除标准的每一遍覆写是否相同，不比较名称
+func (p WipeProfile) samePasses(q WipeProfile) bool {
+	return slices.EqualFunc(p.Passes, q.Passes, func(a, b WipePass) bool {
+		return a.Random == b.Random && bytes.Equal(a.Pattern, b.Pattern)
+	})
+}
+
+// String 描述清除标准，用于日志输出
+func (p WipeProfile) String() string {
+	return fmt.Sprintf("%s (%d passes)", p.Name, len(p.Passes))
+}
@@ -0,0 +1,251 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+// wipeFile 使用指定的覆写器删除文件，返回删除前文件的簇号链
+func wipeFile(t *testing.T, profile WipeProfile, seed []byte) (*MemDriver, *Volume, []uint32) {
+	t.Helper()
+	b := NewVolumeBuilder(512, 4)
+	entry := b.AddFileAt("data.bin", fill(3*2048, 1), 90, 10, 50)
+	driver, vol := buildVolume(t, b)
+	wiper, err := NewWiper(profile, seed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dEntry, dEntryOffset := lookup(t, vol, "data.bin")
+	err = doRemoveFile(vol, &RemoveOptions{Wiper: wiper}, "data.bin", dEntry, dEntryOffset)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return driver, vol, entry.Clusters
+}
+
+// readCluster 读取整个簇
+func readCluster(t *testing.T, vol *Volume, cluster uint32) []byte {
+	t.Helper()
+	buf, err := vol.Driver.ReadSector(vol.clusterSector(cluster), uint16(vol.BPRSector.SectorsPerCluster))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return buf
+}
+
+func TestWipeProfiles(t *testing.T) {
+	wantPasses := map[string]int{"zero": 1, "one": 1, "random": 1, "dod3": 3, "dod7": 7, "gutmann": 35, "nist": 1}
+	for name, passes := range wantPasses {
+		if got := len(WipeProfiles[name].Passes); got != passes {
+			t.Errorf("%s has %d passes, want %d", name, got, passes)
+		}
+	}
+
+	for _, name := range []string{"one", "gutmann", "dod7"} {
+		t.Run(name, func(t *testing.T) {
+			profile := WipeProfiles[name]
+			_, vol, clusters := wipeFile(t, profile, []byte("seed"))
+			last := profile.Passes[len(profile.Passes)-1]
+			for _, cluster := range clusters {
+				buf := readCluster(t, vol, cluster)
+				if last.Random {
+					if bytes.Count(buf, []byte{0}) > len(buf)/16 {
+						t.Errorf("cluster %d does not look random", cluster)
+					}
+					continue
+				}
+				if !bytes.Equal(buf, bytes.Repeat(last.Pattern, len(buf))[:len(buf)]) {
+					t.Errorf("cluster %d does not hold final pattern %x", cluster, last.Pattern)
+				}
+			}
+		})
+	}
+}
+
+func TestParseWipePattern(t *testing.T) {
+	profile, err := ParseWipePattern("0x00, ff,random,0x924924")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(profile.Passes) != 4 || !profile.Passes[2].Random || !bytes.Equal(profile.Passes[3].Pattern, []byte{0x92, 0x49, 0x24}) {
+		t.Errorf("unexpected passes %+v", profile.Passes)
+	}
+	if _, err = ParseWipePattern("0x00,zz"); err == nil {
+		t.Error("invalid pattern accepted")
+	}
+}
+
+func TestWipeRandomSeed(t *testing.T) {
+	profile := WipeProfiles["random"]
+	first, vol, clusters := wipeFile(t, profile, []byte("reproducible"))
+	second, _, _ := wipeFile(t, profile, []byte("reproducible"))
+	other, _, _ := wipeFile(t, profile, []byte("different"))
+	if len(diffBytes(first, second)) != 0 {
+		t.Error("same seed produced different output")
+	}
+	if len(diffBytes(first, other)) == 0 {
+		t.Error("different seeds produced identical output")
+	}
+	a, b := readCluster(t, vol, clusters[0]), readCluster(t, vol, clusters[1])
+	if bytes.Equal(a, b) {
+		t.Error("random data repeats across clusters")
+	}
+}
+
+// dropDriver 丢弃对指定扇区的写入，模拟设备未真正写入数据
+type dropDriver struct {
+	*MemDriver
+	drop uint64
+}
+
+func (d *dropDriver) WriteData(data []byte, sectorNum uint64, offset uint16) error {
+	size := uint64(d.BytesPerSector)
+	end := sectorNum + (uint64(offset)+uint64(len(data))+size-1)/size
+	if d.drop < sectorNum || d.drop >= end {
+		return d.MemDriver.WriteData(data, sectorNum, offset)
+	}
+	// 多扇区写入时只丢弃指定扇区的部分
+	before := int((d.drop-sectorNum)*size) - int(offset)
+	if before > 0 {
+		err := d.MemDriver.WriteData(data[:before], sectorNum, offset)
+		if err != nil {
+			return err
+		}
+	}
+	if after := before + int(size); after < len(data) {
+		return d.MemDriver.WriteData(data[after:], d.drop+1, 0)
+	}
+	return nil
+}
+
+func TestWipeFinalVerify(t *testing.T) {
+	b := NewVolumeBuilder(512, 4)
+	b.AddFile("data.bin", fill(2048, 1))
+	driver, vol := buildVolume(t, b)
+	dEntry, dEntryOffset := lookup(t, vol, "data.bin")
+	vol.Driver = &dropDriver{MemDriver: driver, drop: vol.clusterSector(uint32(dEntry.ClusterLow)) + 2}
+
+	wiper, err := NewWiper(WipeProfiles["dod3"], []byte("seed"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = doRemoveFile(vol, &RemoveOptions{Wiper: wiper}, "data.bin", dEntry, dEntryOffset)
+	var verifyErr *VerifyError
+	if !errors.As(err, &verifyErr) {
+		t.Fatalf("error = %v, want VerifyError", err)
+	}
+	if len(verifyErr.Sectors) != 1 || verifyErr.Sectors[0] != vol.Driver.(*dropDriver).drop {
+		t.Errorf("mismatching sectors %v", verifyErr.Sectors)
+	}
+}
+
+func TestSectorRuns(t *testing.T) {
+	for _, c := range []struct {
+		sectors []uint64
+		max     uint64
+		want    []sectorRun
+	}{
+		{[]uint64{5, 3, 4, 10, 11, 4}, 8, []sectorRun{{3, 3}, {10, 2}}},
+		// 不跨越 max 的整数倍
+		{[]uint64{6, 7, 8, 9, 10}, 4, []sectorRun{{6, 2}, {8, 3}}},
+		{[]uint64{1, 2, 3}, 1, []sectorRun{{1, 1}, {2, 1}, {3, 1}}},
+		{nil, 4, nil},
+	} {
+		if got := sectorRuns(c.sectors, c.max); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%v max %d: got %v, want %v", c.sectors, c.max, got, c.want)
+		}
+	}
+}
+
+// recordDriver 记录数据区中每次写入的起始扇区与扇区数
+type recordDriver struct {
+	*MemDriver
+	from   uint64
+	writes []sectorRun
+}
+
+func (d *recordDriver) WriteData(data []byte, sectorNum uint64, offset uint16) error {
+	if sectorNum >= d.from {
+		d.writes = append(d.writes, sectorRun{Start: sectorNum, Count: uint64(len(data)) / uint64(d.BytesPerSector)})
+	}
+	return d.MemDriver.WriteData(data, sectorNum, offset)
+}
+
+func TestWipeCoalescedWrites(t *testing.T) {
+	wipe := func(bufferSize int) (*MemDriver, *recordDriver, *Wiper) {
+		b := NewVolumeBuilder(512, 4)
+		b.AddFileAt("data.bin", fill(11*2048, 1), 40, 10, 11, 12, 13, 14, 15, 16, 17, 30, 41)
+		mem, vol := buildVolume(t, b)
+		driver := &recordDriver{MemDriver: mem, from: vol.clusterSector(10)}
+		vol.Driver = driver
+		wiper, _ := NewWiper(WipeProfiles["random"], []byte("seed"))
+		wiper.BufferSize = bufferSize
+		dEntry, offsets := lookup(t, vol, "data.bin")
+		err := doRemoveFile(vol, &RemoveOptions{Wiper: wiper, Verify: true}, "data.bin", dEntry, offsets)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return mem, driver, wiper
+	}
+
+	single, singleDriver, _ := wipe(512)
+	if len(singleDriver.writes) != 44 {
+		t.Errorf("one sector per write: %d writes, want 44", len(singleDriver.writes))
+	}
+	// 簇10-17、30与40-41合并为连续段，每次写入不超过16个扇区且不跨越16扇区边界
+	mem, driver, wiper := wipe(8 << 10)
+	if len(driver.writes) > 6 {
+		t.Errorf("%d writes: %v", len(driver.writes), driver.writes)
+	}
+	for _, w := range driver.writes {
+		if w.Count > 16 || w.Start%16+w.Count > 16 {
+			t.Errorf("write of %d sectors at %d crosses a 16 sector boundary", w.Count, w.Start)
+		}
+	}
+	if wiper.Stats.Bytes != 44*512 || wiper.Stats.Writes != uint64(len(driver.writes)) {
+		t.Errorf("stats %+v", wiper.Stats)
+	}
+	// 随机数据与逐扇区写入完全一致
+	if diff := diffBytes(single, mem); len(diff) != 0 {
+		t.Errorf("%d bytes differ from sector by sector wipe", len(diff))
+	}
+}
+
+// BenchmarkWipe 在镜像文件上比较逐扇区写入与合并写入的覆写速度
+func BenchmarkWipe(b *testing.B) {
+	builder := NewVolumeBuilder(512, 8)
+	entry := builder.AddFile("big.bin", fill(16<<20, 1))
+	mem, err := builder.Build()
+	if err != nil {
+		b.Fatal(err)
+	}
+	image := saveImage(b, mem)
+	for _, size := range []int{512, 64 << 10, DefaultWipeBufferSize} {
+		b.Run(fmt.Sprintf("buffer=%d", size), func(b *testing.B) {
+			driver := &ImageDriver{}
+			err := driver.DInit(image)
+			if err != nil {
+				b.Fatal(err)
+			}
+			defer driver.DDestroy()
+			vol, err := NewVolume(driver)
+			if err != nil {
+				b.Fatal(err)
+			}
+			wiper, _ := NewWiper(WipeProfiles["zero"], nil)
+			wiper.BufferSize = size
+			opts := &RemoveOptions{Wiper: wiper}
+			b.SetBytes(int64(len(entry.Content)))
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				err = cleanFileContent(vol, opts, entry.Clusters)
+				if err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}